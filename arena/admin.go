@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+// The admin endpoint is plain HTTP with text replies, enabled by -admin.
+// It has no authentication, thus it should listen on loopback only.
+// Commands run inside the room service loop, see adminRun.
+//
+//	GET  /rooms                          list rooms
+//	GET  /players?room=main              list players: addr state id team life fuel name
+//	POST /kick?room=main&addr=1.2.3.4:5  disconnect player, the cannon is removed
+//	POST /reset?room=main                reset team scores
+//	POST /pause?room=main                pause the world
+//	POST /resume?room=main               resume the world
+//	POST /tick?room=main&update=1s&step=50ms  change update and step intervals
+//	POST /broadcast?room=main&text=hello      show text to players, empty room means all rooms
+
+// adminCmd is run by the room service loop, which sends back the reply.
+type adminCmd struct {
+	run   func(w *world, now time.Time) string
+	reply chan string
+}
+
+// adminTimeout bounds the wait for a room service loop stuck on a slow room.
+const adminTimeout = 5 * time.Second
+
+var errAdminTimeout = errors.New("room did not reply in time")
+
+// adminRun hands the command to the room service loop and waits for the reply until deadline.
+// A room missing the deadline may still run the command later, its reply is discarded.
+// Metrics collection uses it too, see collectRoomStats.
+func (s *server) adminRun(room string, deadline time.Time, run func(w *world, now time.Time) string) (string, error) {
+	s.mutex.Lock()
+	w, found := s.rooms[room]
+	s.mutex.Unlock()
+	if !found {
+		return "", fmt.Errorf("room not found: %s", room)
+	}
+
+	cmd := adminCmd{run: run, reply: make(chan string, 1)}
+
+	timer := s.clock.NewTimer(deadline.Sub(s.clock.Now()))
+	defer timer.Stop()
+
+	select {
+	case w.admin <- cmd:
+	case <-w.quit:
+		return "", fmt.Errorf("room removed: %s", room)
+	case <-timer.C():
+		return "", fmt.Errorf("%w: %s", errAdminTimeout, room)
+	}
+
+	select {
+	case r := <-cmd.reply:
+		return r, nil
+	case <-w.quit:
+		return "", fmt.Errorf("room removed: %s", room)
+	case <-timer.C():
+		return "", fmt.Errorf("%w: %s", errAdminTimeout, room)
+	}
+}
+
+// listenAndServeAdmin serves admin commands until the context is canceled.
+func listenAndServeAdmin(ctx context.Context, s *server, addr string) error {
+
+	log.Printf("serving admin on %s", addr)
+
+	listener, errListen := net.Listen("tcp", addr)
+	if errListen != nil {
+		return fmt.Errorf("listenAndServeAdmin: %s: %v", addr, errListen)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rooms", func(rw http.ResponseWriter, r *http.Request) {
+		for _, room := range s.roomList() {
+			fmt.Fprintf(rw, "%s %d\n", room.Name, room.Clients)
+		}
+	})
+	mux.HandleFunc("/players", adminHandler(s, http.MethodGet, adminPlayers))
+	mux.HandleFunc("/kick", adminHandler(s, http.MethodPost, adminKick))
+	mux.HandleFunc("/reset", adminHandler(s, http.MethodPost, adminReset))
+	mux.HandleFunc("/pause", adminHandler(s, http.MethodPost, adminPause))
+	mux.HandleFunc("/resume", adminHandler(s, http.MethodPost, adminResume))
+	mux.HandleFunc("/tick", adminHandler(s, http.MethodPost, adminTick))
+	mux.HandleFunc("/broadcast", adminBroadcastHandler(s))
+
+	server := &http.Server{Handler: mux}
+	go shutdownHTTP(ctx, server, adminTimeout)
+
+	go func() {
+		errServe := server.Serve(listener)
+		log.Printf("listenAndServeAdmin: %s: %v", addr, errServe)
+	}()
+
+	return nil
+}
+
+// adminCommand builds the command from request parameters, or reports a bad request.
+type adminCommand func(r *http.Request) (func(w *world, now time.Time) string, error)
+
+// adminHandler runs the command in the room given by the room parameter, defaulting to main room.
+func adminHandler(s *server, method string, command adminCommand) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(rw, "method not allowed, use "+method, http.StatusMethodNotAllowed)
+			return
+		}
+		run, errCmd := command(r)
+		if errCmd != nil {
+			http.Error(rw, errCmd.Error(), http.StatusBadRequest)
+			return
+		}
+		room := adminRoom(r)
+		reply, errRun := s.adminRun(room, s.clock.Now().Add(adminTimeout), run)
+		if errRun != nil {
+			status := http.StatusNotFound
+			if errors.Is(errRun, errAdminTimeout) {
+				status = http.StatusGatewayTimeout
+			}
+			http.Error(rw, errRun.Error(), status)
+			return
+		}
+		log.Printf("admin: %s %s room=%s from %s: %s", r.Method, r.URL.Path, room, r.RemoteAddr, strings.TrimSpace(reply))
+		fmt.Fprint(rw, reply)
+	}
+}
+
+func adminRoom(r *http.Request) string {
+	room := strings.TrimSpace(r.FormValue("room"))
+	if room == "" {
+		return msg.DefaultRoom
+	}
+	return room
+}
+
+func adminPlayers(r *http.Request) (func(w *world, now time.Time) string, error) {
+	return func(w *world, now time.Time) string {
+		var b strings.Builder
+		for _, p := range w.playerTab {
+			state := "player"
+			switch {
+			case p.spectator:
+				state = "spectator"
+			case p.queued:
+				state = "queued"
+			}
+			var life, fuel float32
+			id, team := -1, msg.TeamSpectator
+			if state == "player" {
+				life, fuel, _ = w.sim.Status(p.id, now)
+				id, team = p.id, p.team
+			}
+			fmt.Fprintf(&b, "%v %s %d %d %.2f %.2f %s\n", p.conn.RemoteAddr(), state, id, team, life, fuel, p.name)
+		}
+		return b.String()
+	}, nil
+}
+
+func adminKick(r *http.Request) (func(w *world, now time.Time) string, error) {
+	addr := r.FormValue("addr")
+	if addr == "" {
+		return nil, fmt.Errorf("missing addr, see /players")
+	}
+	return func(w *world, now time.Time) string {
+		for _, p := range w.playerTab {
+			if p.conn.RemoteAddr().String() == addr {
+				p.kicked = true
+				p.conn.Close() // connection handler deregisters player
+				return fmt.Sprintf("kicked: %v\n", p)
+			}
+		}
+		return fmt.Sprintf("player not found: %s\n", addr)
+	}, nil
+}
+
+func adminReset(r *http.Request) (func(w *world, now time.Time) string, error) {
+	return func(w *world, now time.Time) string {
+		w.sim.ResetScores()
+		updateWorld(w, now, false)
+		return "scores reset\n"
+	}, nil
+}
+
+func adminPause(r *http.Request) (func(w *world, now time.Time) string, error) {
+	return func(w *world, now time.Time) string {
+		updateWorld(w, now, false) // last update before freezing
+		w.sim.Pause(now)
+		updateWorld(w, now, false)
+		return "paused\n"
+	}, nil
+}
+
+func adminResume(r *http.Request) (func(w *world, now time.Time) string, error) {
+	return func(w *world, now time.Time) string {
+		w.sim.Resume(now)
+		updateWorld(w, now, false)
+		return "resumed\n"
+	}, nil
+}
+
+func adminTick(r *http.Request) (func(w *world, now time.Time) string, error) {
+	update, errUpdate := adminDuration(r, "update")
+	if errUpdate != nil {
+		return nil, errUpdate
+	}
+	step, errStep := adminDuration(r, "step")
+	if errStep != nil {
+		return nil, errStep
+	}
+	return func(w *world, now time.Time) string {
+		if update > 0 {
+			w.updateInterval = update
+			w.config.UpdateInterval = duration(update)
+		}
+		if step > 0 {
+			w.stepInterval = step
+			w.config.StepInterval = duration(step)
+		}
+		updateWorld(w, now, false) // broadcast new interval
+		return fmt.Sprintf("update=%v step=%v\n", w.updateInterval, w.stepInterval)
+	}, nil
+}
+
+// adminDuration parses an optional positive duration parameter. Zero means missing.
+func adminDuration(r *http.Request, name string) (time.Duration, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive: %v", name, d)
+	}
+	return d, nil
+}
+
+// adminBroadcastHandler sends the text to the given room, or to all rooms.
+func adminBroadcastHandler(s *server) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed, use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		text := strings.TrimSpace(r.FormValue("text"))
+		if text == "" {
+			http.Error(rw, "missing text", http.StatusBadRequest)
+			return
+		}
+		var rooms []string
+		if room := strings.TrimSpace(r.FormValue("room")); room != "" {
+			rooms = []string{room}
+		} else {
+			for _, room := range s.roomList() {
+				rooms = append(rooms, room.Name)
+			}
+		}
+		broadcast := func(w *world, now time.Time) string {
+			w.notice = text
+			updateWorld(w, now, false)
+			w.notice = ""
+			return fmt.Sprintf("room %s: broadcast to %d clients\n", w.room, len(w.playerTab))
+		}
+		deadline := s.clock.Now().Add(adminTimeout)
+		for _, room := range rooms {
+			reply, err := s.adminRun(room, deadline, broadcast)
+			if err != nil {
+				reply = err.Error() + "\n"
+			}
+			log.Printf("admin: broadcast %q from %s: %s", text, r.RemoteAddr, strings.TrimSpace(reply))
+			fmt.Fprint(rw, reply)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+)
+
+// addrConn reports a distinct remote address for each test player.
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func newAdminServer() (*server, *world, *clock.Fake) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	// wide cannons keep the cannons aligned, thus every missile hits
+	s := &server{clock: clk, config: defaultConfig(), profiles: newProfileStore(10), rooms: map[string]*world{},
+		cannonWidth: 1, cannonHeight: .2, missileWidth: .05, missileHeight: .1}
+	w := newWorld(s, msg.DefaultRoom)
+	s.rooms[w.room] = w
+	return s, w, clk
+}
+
+// joinAdmin registers the player like the connection handler,
+// which deregisters the player when the connection is closed.
+func joinAdmin(w *world, name string) (*player, chan struct{}) {
+	conn, peer := net.Pipe()
+	p := &player{
+		conn:     addrConn{conn, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: len(w.playerTab) + 1}},
+		output:   newOutput(),
+		playerID: name,
+		name:     name,
+		joined:   make(chan msg.Welcome, 1),
+		room:     w.room,
+	}
+	w.playerAdd <- p
+	<-p.joined
+	gone := make(chan struct{})
+	go func() {
+		defer peer.Close()
+		conn.Read(make([]byte, 1)) // returns when kicked
+		select {
+		case w.playerDel <- p:
+		case <-w.quit:
+		}
+		close(gone)
+	}()
+	return p, gone
+}
+
+func adminRequest(h http.HandlerFunc, method, target string) (int, string) {
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(method, target, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestAdminKick(t *testing.T) {
+	s, w, _ := newAdminServer()
+	go serve(w)
+	defer close(w.quit)
+
+	p1, gone := joinAdmin(w, "player1")
+	joinAdmin(w, "player2")
+
+	addr := p1.conn.RemoteAddr().String()
+	if code, body := adminRequest(adminHandler(s, http.MethodPost, adminKick), http.MethodPost, "/kick?addr="+addr); code != http.StatusOK || !strings.HasPrefix(body, "kicked") {
+		t.Fatalf("kick: status=%d body=%q", code, body)
+	}
+	<-gone
+
+	_, players := adminRequest(adminHandler(s, http.MethodGet, adminPlayers), http.MethodGet, "/players")
+	if strings.Contains(players, addr) || !strings.Contains(players, "player2") {
+		t.Errorf("players after kick: %q", players)
+	}
+
+	if code, _ := adminRequest(adminHandler(s, http.MethodPost, adminKick), http.MethodPost, "/kick"); code != http.StatusBadRequest {
+		t.Errorf("kick without addr: status=%d", code)
+	}
+}
+
+func TestAdminReset(t *testing.T) {
+	s, w, clk := newAdminServer()
+
+	id0, _ := w.sim.AddPlayer(clk.Now(), sim.AnyTeam)
+	w.sim.AddPlayer(clk.Now(), sim.AnyTeam)
+	for i := 0; i < 100 && w.sim.Scores() == [2]int{}; i++ {
+		w.sim.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now())
+		for j := 0; j < 10; j++ {
+			clk.Advance(100 * time.Millisecond)
+			w.sim.Step(clk.Now())
+		}
+	}
+	if w.sim.Scores() == [2]int{} {
+		t.Fatalf("no score to reset")
+	}
+
+	go serve(w)
+	defer close(w.quit)
+	p, _ := joinAdmin(w, "player1")
+
+	if code, body := adminRequest(adminHandler(s, http.MethodPost, adminReset), http.MethodPost, "/reset"); code != http.StatusOK {
+		t.Fatalf("reset: status=%d body=%q", code, body)
+	}
+	if u := <-p.output; u.Scores != [2]int{} {
+		t.Errorf("update after reset: scores=%v", u.Scores)
+	}
+}
+
+func TestAdminTick(t *testing.T) {
+	s, w, clk := newAdminServer()
+	go serve(w)
+	defer close(w.quit)
+
+	interval := func() (update, step time.Duration) {
+		s.adminRun(w.room, clk.Now().Add(time.Hour), func(w *world, now time.Time) string {
+			update, step = w.updateInterval, w.stepInterval
+			return ""
+		})
+		return
+	}
+	update, step := interval()
+
+	tick := adminHandler(s, http.MethodPost, adminTick)
+	for _, target := range []string{"/tick?update=-1s", "/tick?update=0s", "/tick?step=bogus", "/tick?update=2s&step=-50ms"} {
+		if code, body := adminRequest(tick, http.MethodPost, target); code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d body=%q", target, code, body)
+		}
+		if u, st := interval(); u != update || st != step {
+			t.Errorf("%s: intervals changed: update=%v step=%v", target, u, st)
+		}
+	}
+
+	if code, body := adminRequest(tick, http.MethodPost, "/tick?update=2s"); code != http.StatusOK {
+		t.Fatalf("tick: status=%d body=%q", code, body)
+	}
+	if u, st := interval(); u != 2*time.Second || st != step {
+		t.Errorf("tick: update=%v step=%v", u, st)
+	}
+}
+
+func TestAdminBroadcast(t *testing.T) {
+	s, w, _ := newAdminServer()
+	go serve(w)
+	defer close(w.quit)
+	p, _ := joinAdmin(w, "player1")
+
+	broadcast := adminBroadcastHandler(s)
+	if code, _ := adminRequest(broadcast, http.MethodPost, "/broadcast"); code != http.StatusBadRequest {
+		t.Errorf("broadcast without text: status=%d", code)
+	}
+	if code, body := adminRequest(broadcast, http.MethodPost, "/broadcast?text=hello"); code != http.StatusOK || !strings.Contains(body, "broadcast to 1 clients") {
+		t.Fatalf("broadcast: status=%d body=%q", code, body)
+	}
+	if u := <-p.output; u.Notice != "hello" {
+		t.Errorf("update after broadcast: notice=%q", u.Notice)
+	}
+
+	// notice is sent once
+	adminRequest(adminHandler(s, http.MethodPost, adminReset), http.MethodPost, "/reset")
+	if u := <-p.output; u.Notice != "" {
+		t.Errorf("update after reset: notice=%q", u.Notice)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/future"
+	"github.com/udhos/fugo/msg"
+)
+
+// config holds the game rules loaded from the JSON file given by -config.
+// Fields missing from the file keep their default values.
+// See docs/arena_config.json.
+type config struct {
+	CannonImage    string   `json:"cannon_image"`
+	MissileImage   string   `json:"missile_image"`
+	UpdateInterval duration `json:"update_interval"` // housekeeping: detached cannons expiry, matchmaking
+	StepInterval   duration `json:"step_interval"`   // minimum delay between scheduled steps
+
+	MissileSpeed  float32 `json:"missile_speed"`
+	CannonSpeed   float32 `json:"cannon_speed"`
+	MissileDamage float32 `json:"missile_damage"`
+	FuelCost      float32 `json:"fuel_cost"`
+	FuelRecharge  float32 `json:"fuel_recharge"`
+	FuelStart     float32 `json:"fuel_start"`
+
+	MissileIntercept bool `json:"missile_intercept"` // opposing missiles destroy each other
+
+	TeamSize     int      `json:"team_size"` // matchmaking, 0 disables queue
+	ScoreLimit   int      `json:"score_limit"`
+	TimeLimit    duration `json:"time_limit"`
+	Countdown    duration `json:"countdown"`
+	RoundOver    duration `json:"round_over"`
+	Respawn      duration `json:"respawn"`
+	Invulnerable duration `json:"invulnerable"`
+}
+
+// duration is a time.Duration written as string in JSON, e.g. "100ms".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration: %s: %v", b, err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func defaultConfig() config {
+	rules := sim.DefaultRules()
+	return config{
+		CannonImage:    "assets/ship.png",
+		MissileImage:   "assets/rocket.png",
+		UpdateInterval: duration(1000 * time.Millisecond),
+		StepInterval:   duration(10 * time.Millisecond),
+		MissileSpeed:   rules.MissileSpeed,
+		CannonSpeed:    rules.CannonSpeed,
+		MissileDamage:  rules.MissileDamage,
+		FuelCost:       rules.FuelCost,
+		FuelRecharge:   rules.FuelRecharge,
+		FuelStart:      rules.FuelStart,
+		ScoreLimit:     5,
+		TimeLimit:      duration(5 * time.Minute),
+		Countdown:      duration(5 * time.Second),
+		RoundOver:      duration(5 * time.Second),
+		Respawn:        duration(3 * time.Second),
+		Invulnerable:   duration(2 * time.Second),
+	}
+}
+
+// loadConfig reads the config file on top of defaults.
+// Empty path returns defaults.
+func loadConfig(path string) (config, error) {
+	c := defaultConfig()
+	if path == "" {
+		return c, nil
+	}
+
+	f, errOpen := os.Open(path)
+	if errOpen != nil {
+		return c, fmt.Errorf("loadConfig: %v", errOpen)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields() // catch misspelled fields
+	if errDec := dec.Decode(&c); errDec != nil {
+		return c, fmt.Errorf("loadConfig: %s: %v", path, errDec)
+	}
+
+	if errValid := c.validate(); errValid != nil {
+		return c, fmt.Errorf("loadConfig: %s: %v", path, errValid)
+	}
+
+	return c, nil
+}
+
+func (c config) validate() error {
+	switch {
+	case c.CannonImage == "":
+		return fmt.Errorf("cannon_image is empty")
+	case c.MissileImage == "":
+		return fmt.Errorf("missile_image is empty")
+	case c.UpdateInterval <= 0:
+		return fmt.Errorf("update_interval must be positive: %v", time.Duration(c.UpdateInterval))
+	case c.StepInterval <= 0:
+		return fmt.Errorf("step_interval must be positive: %v", time.Duration(c.StepInterval))
+	case c.MissileSpeed <= 0:
+		return fmt.Errorf("missile_speed must be positive: %v", c.MissileSpeed)
+	case c.CannonSpeed < 0:
+		return fmt.Errorf("cannon_speed must not be negative: %v", c.CannonSpeed)
+	case c.MissileDamage <= 0 || c.MissileDamage > 1:
+		return fmt.Errorf("missile_damage must be in (0,1]: %v", c.MissileDamage)
+	case c.FuelCost < 0 || c.FuelCost > future.FuelMax:
+		return fmt.Errorf("fuel_cost must be in [0,%v]: %v", future.FuelMax, c.FuelCost)
+	case c.FuelRecharge <= 0:
+		return fmt.Errorf("fuel_recharge must be positive: %v", c.FuelRecharge)
+	case c.FuelStart < 0 || c.FuelStart > future.FuelMax:
+		return fmt.Errorf("fuel_start must be in [0,%v]: %v", future.FuelMax, c.FuelStart)
+	case c.TeamSize < 0:
+		return fmt.Errorf("team_size must not be negative: %d", c.TeamSize)
+	case c.ScoreLimit < 0:
+		return fmt.Errorf("score_limit must not be negative: %d", c.ScoreLimit)
+	case c.TimeLimit < 0 || c.Countdown < 0 || c.RoundOver < 0:
+		return fmt.Errorf("time_limit, countdown and round_over must not be negative")
+	case c.Respawn < 0 || c.Invulnerable < 0:
+		return fmt.Errorf("respawn and invulnerable must not be negative")
+	}
+	return nil
+}
+
+func (c config) rules() msg.Rules {
+	return msg.Rules{
+		MissileSpeed:  c.MissileSpeed,
+		CannonSpeed:   c.CannonSpeed,
+		MissileDamage: c.MissileDamage,
+		FuelCost:      c.FuelCost,
+		FuelRecharge:  c.FuelRecharge,
+		FuelStart:     c.FuelStart,
+
+		MissileIntercept: c.MissileIntercept,
+	}
+}
+
+func (c config) match() sim.MatchConfig {
+	return sim.MatchConfig{
+		ScoreLimit: c.ScoreLimit,
+		TimeLimit:  time.Duration(c.TimeLimit),
+		Countdown:  time.Duration(c.Countdown),
+		RoundOver:  time.Duration(c.RoundOver),
+		TeamSize:   c.TeamSize,
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigDefault(t *testing.T) {
+	c, err := loadConfig("../docs/arena_config.json")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if d := defaultConfig(); c != d {
+		t.Errorf("docs/arena_config.json differs from defaults:\nfile:     %+v\ndefaults: %+v", c, d)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	dir, errDir := ioutil.TempDir("", "arena_config")
+	if errDir != nil {
+		t.Fatalf("tempdir: %v", errDir)
+	}
+	defer os.RemoveAll(dir)
+
+	bad := []string{
+		`{"missile_speed": 0}`,
+		`{"missile_damage": 2}`,
+		`{"step_interval": "-1s"}`,
+		`{"step_interval": "fast"}`,
+		`{"misile_speed": 1}`, // unknown field
+	}
+
+	for _, b := range bad {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(b), 0640); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := loadConfig(path); err == nil {
+			t.Errorf("invalid config accepted: %s", b)
+		}
+	}
+}
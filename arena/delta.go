@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/udhos/fugo/msg"
+)
+
+const (
+	keyframeInterval = 10 // send full update after this many deltas
+	deltaHistoryMax  = 30 // unacknowledged updates kept, beyond that client gets a keyframe
+)
+
+// deltaState tracks updates sent to one connection.
+type deltaState struct {
+	seq           int               // last update sent
+	acked         int               // last update acknowledged by client
+	history       map[int]msg.State // sent states not yet superseded by an ack
+	sinceKeyframe int
+}
+
+// encode turns the full update into a delta relative to the last acknowledged update,
+// or into a keyframe if there is no usable base.
+func (d *deltaState) encode(u *msg.Update) {
+	if d.history == nil {
+		d.history = map[int]msg.State{}
+	}
+
+	cur := msg.NewState(*u)
+
+	d.seq++
+	u.Seq = d.seq
+
+	u.Base = d.acked
+
+	base, found := d.history[d.acked]
+	if !found || d.sinceKeyframe >= keyframeInterval || len(d.history) >= deltaHistoryMax {
+		// keyframe
+		cur.Fill(u)
+		u.Full = true
+		d.sinceKeyframe = 0
+		if len(d.history) >= deltaHistoryMax {
+			d.history = map[int]msg.State{} // client is not acking, forget old updates
+		}
+	} else {
+		cur.Delta(base, u)
+		d.sinceKeyframe++
+	}
+
+	d.history[d.seq] = cur
+}
+
+// ack records that the client has the update seq, so it can be used as delta base.
+func (d *deltaState) ack(seq int) bool {
+	if seq <= d.acked {
+		return false // stale
+	}
+	if _, found := d.history[seq]; !found {
+		return false // unknown
+	}
+	d.acked = seq
+	for s := range d.history {
+		if s < seq {
+			delete(d.history, s)
+		}
+	}
+	return true
+}
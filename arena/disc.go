@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net"
+	"strings"
+
+	"github.com/udhos/fugo/msg"
 )
 
-func lanDiscovery(addr string) error {
+// discoveryReplyMax keeps the reply within the client read buffer.
+const discoveryReplyMax = 900
+
+// lanDiscovery replies to discovery requests with the listen address in the first line,
+// followed by one line per room: name and number of clients.
+// It stops when the context is canceled.
+func lanDiscovery(ctx context.Context, s *server, addr string) error {
 
 	listen := "239.1.1.1:8888"
 	proto := "udp"
@@ -22,22 +33,46 @@ func lanDiscovery(addr string) error {
 		return errListen
 	}
 
+	go func() {
+		<-ctx.Done()
+		conn.Close() // break read loop
+	}()
+
 	go func() {
 		buf := make([]byte, 1000)
 		for {
 			_, src, errRead := conn.ReadFromUDP(buf)
 			if errRead != nil {
+				if ctx.Err() != nil {
+					log.Printf("discovery: stopped")
+					return
+				}
 				log.Printf("discovery read error from %v: %v", src, errRead)
 				continue
 			}
-			_, errWrite := conn.WriteTo([]byte(addr), src)
+			reply := discoveryReply(addr, s.roomList())
+			_, errWrite := conn.WriteTo([]byte(reply), src)
 			if errWrite != nil {
 				log.Printf("discovery write error to %v: %v", src, errWrite)
 				continue
 			}
-			log.Printf("discovery: replied %s to %v", addr, src)
+			log.Printf("discovery: replied %q to %v", reply, src)
 		}
 	}()
 
 	return nil
 }
+
+func discoveryReply(addr string, rooms []msg.Room) string {
+	var b strings.Builder
+	b.WriteString(addr)
+	b.WriteString("\n")
+	for _, r := range rooms {
+		line := fmt.Sprintf("%s %d\n", r.Name, r.Clients)
+		if b.Len()+len(line) > discoveryReplyMax {
+			break // truncate room list
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/udhos/fugo/msg"
+	"github.com/udhos/fugo/version"
+)
+
+const (
+	handshakeTimeout = 10 * time.Second
+	nameMaxLen       = 20
+	playerIDMaxLen   = 64
+)
+
+// handshake reads the preamble, then waits for client Hello and validates it.
+// Hello is read from r, which must read from br, see msg.ReadPreamble.
+// It returns the encoder for Welcome, in the codec chosen by the preamble.
+// A refused client receives a Welcome message telling the reason,
+// and handshake returns an error.
+// An accepted client is welcomed later, once registered by the service loop.
+func handshake(conn net.Conn, br *bufio.Reader, r *limitReader, w io.Writer) (msg.Hello, msg.Encoder, error) {
+	var hello msg.Hello
+
+	if errDeadline := conn.SetReadDeadline(time.Now().Add(handshakeTimeout)); errDeadline != nil {
+		return hello, nil, fmt.Errorf("handshake: deadline: %v", errDeadline)
+	}
+	codec, legacy, errPreamble := msg.ReadPreamble(br)
+	if errPreamble != nil {
+		return hello, nil, fmt.Errorf("handshake: preamble: %v", errPreamble)
+	}
+	var dec msg.Decoder
+	var enc msg.Encoder
+	if legacy {
+		dec = gobHelloDecoder{gob.NewDecoder(r)}
+		enc = gob.NewEncoder(w) // plain value, see errRefuse
+	} else {
+		dec = codec.NewDecoderLimit(r, r.max)
+		enc = codec.NewEncoder(w)
+	}
+	m, errDec := dec.Decode()
+	if errDec != nil {
+		return hello, nil, fmt.Errorf("handshake: decode hello: %v", errDec)
+	}
+	hello, isHello := m.(msg.Hello)
+	if !isHello {
+		return hello, nil, fmt.Errorf("handshake: expected hello, got %T", m)
+	}
+	if errDeadline := conn.SetReadDeadline(time.Time{}); errDeadline != nil {
+		return hello, nil, fmt.Errorf("handshake: deadline: %v", errDeadline)
+	}
+
+	log.Printf("handshake: %v: codec=%s legacy=%v %+v", conn.RemoteAddr(), codec.Name(), legacy, hello)
+
+	hello.Room = strings.TrimSpace(hello.Room)
+	if hello.Room == "" {
+		hello.Room = msg.DefaultRoom
+	}
+
+	hello.PlayerID = strings.TrimSpace(hello.PlayerID)
+	hello.Name = strings.TrimSpace(hello.Name)
+	hello.Name = truncate(hello.Name, nameMaxLen)
+
+	var reason string
+
+	switch {
+	case hello.Protocol != msg.Protocol:
+		reason = fmt.Sprintf("incompatible protocol: client version %s protocol %d, server version %s protocol %d - please upgrade",
+			hello.Version, hello.Protocol, version.Version, msg.Protocol)
+	case len(hello.PlayerID) > playerIDMaxLen:
+		reason = fmt.Sprintf("bad player ID: length %d exceeds %d", len(hello.PlayerID), playerIDMaxLen)
+	case len(hello.Room) > nameMaxLen:
+		reason = fmt.Sprintf("bad room name: length %d exceeds %d", len(hello.Room), nameMaxLen)
+	case strings.IndexFunc(hello.Room, unicode.IsSpace) >= 0:
+		reason = fmt.Sprintf("bad room name: %q has spaces", hello.Room)
+	}
+
+	if reason != "" {
+		return hello, enc, errRefuse(enc, reason)
+	}
+
+	return hello, enc, nil
+}
+
+// gobHelloDecoder reads Hello from legacy clients, which send it as plain gob value.
+type gobHelloDecoder struct {
+	dec *gob.Decoder
+}
+
+func (d gobHelloDecoder) Decode() (interface{}, error) {
+	var hello msg.Hello
+	err := d.dec.Decode(&hello)
+	return hello, err
+}
+
+// errRefuse sends Welcome refusing the client for reason.
+// It returns the error to report.
+func errRefuse(enc msg.Encoder, reason string) error {
+	welcome := newWelcome()
+	welcome.Accepted = false
+	welcome.Reason = reason
+	if errEnc := enc.Encode(welcome); errEnc != nil {
+		return fmt.Errorf("handshake: encode welcome: %v", errEnc)
+	}
+	return fmt.Errorf("handshake: refused: %s", reason)
+}
+
+// truncate cuts s to at most max bytes, on a rune boundary.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max-- // do not split multi-byte rune
+	}
+	return s[:max]
+}
+
+func newWelcome() msg.Welcome {
+	return msg.Welcome{
+		Version:  version.Version,
+		Protocol: msg.Protocol,
+		Accepted: true,
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, c := range []struct {
+		s        string
+		max      int
+		expected string
+	}{
+		{"player", 20, "player"},
+		{"abcdef", 3, "abc"},
+		{"aé", 2, "a"}, // é is 2 bytes
+		{"ééé", 5, "éé"},
+		{"日本語", 4, "日"}, // 3 bytes each
+	} {
+		result := truncate(c.s, c.max)
+		if result != c.expected || !utf8.ValidString(result) {
+			t.Errorf("truncate(%q,%d): expected=%q result=%q", c.s, c.max, c.expected, result)
+		}
+	}
+}
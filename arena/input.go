@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+// Client input is checked in the connection reader, before reaching the room service loop:
+// messages larger than inputMax break the connection, inputs beyond the token bucket rate
+// and unknown buttons are dropped, and a client with too many dropped inputs within
+// inputAbuseWindow is disconnected. Acks are not rate limited, since the client acks
+// every update; stale acks are ignored and acks for updates never written are dropped.
+
+var errInputTooBig = errors.New("input message too big")
+
+// limitReader fails when a single message reads more than max bytes.
+// It implements io.ByteReader, thus gob decoder does not read ahead,
+// and the codec decoder can continue from the same reader after handshake.
+type limitReader struct {
+	r   *bufio.Reader
+	n   int // bytes read since reset
+	max int
+}
+
+func newLimitReader(r *bufio.Reader, max int) *limitReader {
+	return &limitReader{r: r, max: max}
+}
+
+// reset starts a new message.
+func (l *limitReader) reset() {
+	l.n = 0
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	if l.n >= l.max {
+		return 0, errInputTooBig
+	}
+	if left := l.max - l.n; len(b) > left {
+		b = b[:left]
+	}
+	n, err := l.r.Read(b)
+	l.n += n
+	return n, err
+}
+
+func (l *limitReader) ReadByte() (byte, error) {
+	if l.n >= l.max {
+		return 0, errInputTooBig
+	}
+	c, err := l.r.ReadByte()
+	if err == nil {
+		l.n++
+	}
+	return c, err
+}
+
+// tokenBucket allows rate inputs per second, with bursts up to burst inputs.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// allow takes one token, if available.
+func (t *tokenBucket) allow(now time.Time) bool {
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// inputFilter holds input checks for one connection. It is owned by the reader goroutine.
+type inputFilter struct {
+	bucket   *tokenBucket
+	acked    int         // last ack handed to the service loop
+	written  *int64      // last update seq written to the client, stored by the writer goroutine
+	rejected []time.Time // dropped inputs within window, oldest first
+	abuse    int         // dropped inputs tolerated within window
+	window   time.Duration
+	metrics  *metrics
+}
+
+func newInputFilter(s *server, written *int64, now time.Time) *inputFilter {
+	return &inputFilter{
+		bucket:  newTokenBucket(s.inputRate, s.inputBurst, now),
+		written: written,
+		abuse:   s.inputAbuse,
+		window:  s.inputAbuseWindow,
+		metrics: &s.metrics,
+	}
+}
+
+// check returns true if the input should be handed to the service loop.
+// It returns an error if the client should be disconnected.
+func (f *inputFilter) check(m interface{}, now time.Time) (bool, error) {
+	var counter *int64
+	switch v := m.(type) {
+	case msg.Ack:
+		if v.Seq > int(atomic.LoadInt64(f.written)) {
+			counter = &f.metrics.inputsUnexpected // update never sent
+			break
+		}
+		if v.Seq <= f.acked {
+			return false, nil // stale
+		}
+		f.acked = v.Seq
+		return true, nil
+	case msg.Button:
+		if v.ID != msg.ButtonFire && v.ID != msg.ButtonTurn {
+			counter = &f.metrics.inputsUnknown
+		}
+	default:
+		counter = &f.metrics.inputsUnexpected
+	}
+	if counter == nil && !f.bucket.allow(now) {
+		counter = &f.metrics.inputsRateLimited
+	}
+	if counter == nil {
+		return true, nil
+	}
+
+	atomic.AddInt64(counter, 1)
+	if f.reject(now) {
+		atomic.AddInt64(&f.metrics.abusive, 1)
+		return false, fmt.Errorf("too many rejected inputs: %d within %v, last: %#v", len(f.rejected), f.window, m)
+	}
+	return false, nil
+}
+
+// reject records a dropped input and reports whether the client exceeded
+// the dropped inputs tolerated within the sliding window.
+func (f *inputFilter) reject(now time.Time) bool {
+	expired := 0
+	for expired < len(f.rejected) && now.Sub(f.rejected[expired]) >= f.window {
+		expired++
+	}
+	f.rejected = append(f.rejected[expired:], now)
+	return len(f.rejected) > f.abuse
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(10, 5, now)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if b.allow(now) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("burst: expected=5 allowed=%d", allowed)
+	}
+
+	now = now.Add(200 * time.Millisecond) // 2 tokens
+	allowed = 0
+	for i := 0; i < 10; i++ {
+		if b.allow(now) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("refill: expected=2 allowed=%d", allowed)
+	}
+}
+
+func TestInputFilter(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := &server{inputRate: 1, inputBurst: 10, inputAbuse: 2, inputAbuseWindow: 10 * time.Second}
+	written := int64(0)
+	f := newInputFilter(s, &written, now)
+
+	if accept, err := f.check(msg.Button{ID: msg.ButtonFire}, now); !accept || err != nil {
+		t.Errorf("fire: accept=%v err=%v", accept, err)
+	}
+	if accept, err := f.check(msg.Button{ID: 7}, now); accept || err != nil {
+		t.Errorf("unknown button: accept=%v err=%v", accept, err)
+	}
+	if accept, err := f.check(msg.Update{}, now); accept || err != nil {
+		t.Errorf("unexpected message: accept=%v err=%v", accept, err)
+	}
+	if s.metrics.inputsUnknown != 1 || s.metrics.inputsUnexpected != 1 {
+		t.Errorf("counters: unknown=%d unexpected=%d", s.metrics.inputsUnknown, s.metrics.inputsUnexpected)
+	}
+
+	// rejections older than the window are forgotten
+	now = now.Add(10 * time.Second)
+	if _, err := f.check(msg.Button{ID: -1}, now); err != nil {
+		t.Errorf("client disconnected for rejections outside window: %v", err)
+	}
+	if _, err := f.check(msg.Button{ID: -1}, now); err != nil {
+		t.Errorf("client disconnected within tolerance: %v", err)
+	}
+	if _, err := f.check(msg.Button{ID: -1}, now); err == nil {
+		t.Errorf("abusive client not disconnected")
+	}
+}
+
+func TestInputFilterAck(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := &server{inputRate: 1, inputBurst: 1, inputAbuse: 0, inputAbuseWindow: 10 * time.Second}
+	written := int64(0)
+	f := newInputFilter(s, &written, now)
+
+	// acks are not charged to the token bucket
+	for seq := 1; seq <= 100; seq++ {
+		written = int64(seq)
+		if accept, err := f.check(msg.Ack{Seq: seq}, now); !accept || err != nil {
+			t.Fatalf("ack %d: accept=%v err=%v", seq, accept, err)
+		}
+	}
+	if accept, err := f.check(msg.Button{ID: msg.ButtonFire}, now); !accept || err != nil {
+		t.Errorf("fire after acks: accept=%v err=%v", accept, err)
+	}
+
+	if accept, err := f.check(msg.Ack{Seq: 50}, now); accept || err != nil {
+		t.Errorf("stale ack: accept=%v err=%v", accept, err)
+	}
+	if _, err := f.check(msg.Ack{Seq: 101}, now); err == nil {
+		t.Errorf("ack for update never sent not rejected")
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	r := newLimitReader(bufio.NewReader(bytes.NewReader(make([]byte, 100))), 10)
+
+	buf := make([]byte, 100)
+	n, err := r.Read(buf)
+	if n != 10 || err != nil {
+		t.Errorf("first read: n=%d err=%v", n, err)
+	}
+	if _, err := r.ReadByte(); err != errInputTooBig {
+		t.Errorf("read beyond limit: err=%v", err)
+	}
+
+	r.reset()
+	if _, err := r.ReadByte(); err != nil {
+		t.Errorf("read after reset: err=%v", err)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"encoding/gob"
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
 	_ "image/png" // The _ means to import a package purely for its initialization side effects.
+	"io"
 	"log"
 	"net"
 	"os"
@@ -13,30 +16,40 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/udhos/fugo/future"
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/clock"
 	"github.com/udhos/fugo/msg"
 	"github.com/udhos/fugo/unit"
 	"github.com/udhos/fugo/version"
 )
 
+// world is a room. Its state is owned by the room service loop, see serve.
 type world struct {
-	playerTab      []*player
+	room           string
+	sim            *sim.World
+	clock          clock.Clock
+	playerTab      []*player // connected players and spectators
 	playerAdd      chan *player
 	playerDel      chan *player
 	input          chan inputMsg
 	updateInterval time.Duration
-	missileList    []*msg.Missile
-	teams          [2]team
-	cannonWidth    float64
-	cannonHeight   float64
-	missileWidth   float64
-	missileHeight  float64
-	countConn      int32
-}
-
-type team struct {
-	count int // player count
-	score int // team score
+	stepInterval   time.Duration // minimum delay between scheduled steps, batching close events
+	config         config        // running config
+	reload         chan config   // config reloaded on SIGHUP
+	admin          chan adminCmd // commands from admin endpoint
+	quit           chan struct{} // room removed
+	rulesVersion   int           // increased when rules change, thus players get the new rules
+	profiles       *profileStore // persistent player ID => profile, shared by rooms
+	detached       []*player     // disconnected players waiting for resume
+	queue          []*player     // players waiting for a team slot, see matchmake
+	resumeGrace    time.Duration
+	notice         string        // admin text for the next update
+	lag            time.Duration // last delay between tick and its handling
+	lagMax         time.Duration // client behind for this time is disconnected
+	metrics        *metrics      // server metrics
+
+	clients   int       // connections in room, guarded by server mutex
+	idleSince time.Time // guarded by server mutex
 }
 
 type inputMsg struct {
@@ -45,15 +58,42 @@ type inputMsg struct {
 }
 
 type player struct {
-	conn         net.Conn
-	output       chan msg.Update
-	fuelStart    time.Time
-	cannonStart  time.Time
-	cannonSpeed  float32
-	cannonCoordX float32
-	cannonLife   float32
-	cannonID     int
-	team         int
+	conn      net.Conn
+	output    chan msg.Update
+	id        int    // sim player ID
+	team      int    // sim team
+	playerID  string // persistent identity reported by client
+	name      string
+	profile   *profile
+	spectator bool // receives updates, owns no cannon
+	queued    bool // waiting for a team slot, owns no cannon yet
+	room      string
+
+	rulesVersion int // rules version last sent to player
+
+	resumeToken string
+	joined      chan msg.Welcome // service loop accepted the player
+	replaced    bool             // cannon taken over by new connection
+	kicked      bool             // disconnected by admin or shutdown, cannot resume
+	detachedAt  time.Time
+	behindSince time.Time // writer did not keep up with updates since
+	lagging     bool      // disconnected for staying behind
+	delta       deltaState
+}
+
+// String hides the resume token from logs.
+func (p *player) String() string {
+	var addr net.Addr
+	if p.conn != nil {
+		addr = p.conn.RemoteAddr()
+	}
+	if p.spectator {
+		return fmt.Sprintf("spectator{%v room=%s name=%s}", addr, p.room, p.name)
+	}
+	if p.queued {
+		return fmt.Sprintf("queued{%v room=%s name=%s}", addr, p.room, p.name)
+	}
+	return fmt.Sprintf("player{%v room=%s name=%s id=%d}", addr, p.room, p.name, p.id)
 }
 
 func main() {
@@ -61,249 +101,416 @@ func main() {
 	log.Printf("arena version " + version.Version + " runtime " + runtime.Version())
 
 	var addr string
+	var wsAddr string
+	var grace time.Duration
+	var configFile string
+	var maxRooms int
+	var roomIdle time.Duration
+	var adminAddr string
+	var metricsAddr string
+	var drain time.Duration
+	var lagMax time.Duration
+	var writeTimeout time.Duration
+	var inputRate float64
+	var inputBurst int
+	var inputMax int
+	var inputAbuse int
+	var inputAbuseWindow time.Duration
+	var profiles int
 
 	flag.StringVar(&addr, "addr", ":8080", "listen address")
+	flag.StringVar(&wsAddr, "ws", "", "websocket listen address, e.g. :8081 (empty disables websocket)")
+	flag.DurationVar(&grace, "grace", 30*time.Second, "keep cannon of disconnected player for resuming (0 disables resume)")
+	flag.StringVar(&configFile, "config", "", "game rules JSON file, see docs/arena_config.json (empty uses defaults)")
+	flag.IntVar(&maxRooms, "maxrooms", 20, "maximum number of rooms")
+	flag.DurationVar(&roomIdle, "roomidle", time.Minute, "remove room left empty for this time")
+	flag.StringVar(&adminAddr, "admin", "", "admin HTTP listen address, e.g. 127.0.0.1:8082 (empty disables admin, no authentication)")
+	flag.DurationVar(&drain, "drain", 5*time.Second, "on SIGTERM, wait this long for clients to receive final scores and disconnect")
+	flag.DurationVar(&lagMax, "lagmax", 10*time.Second, "disconnect client not keeping up with updates for this time")
+	flag.DurationVar(&writeTimeout, "writetimeout", 10*time.Second, "disconnect client when writing one update takes this long")
+	flag.Float64Var(&inputRate, "inputrate", 20, "client inputs allowed per second, excess is dropped")
+	flag.IntVar(&inputBurst, "inputburst", 40, "client inputs allowed in a burst")
+	flag.IntVar(&inputMax, "inputmax", 4096, "maximum size in bytes of a client message, larger breaks the connection")
+	flag.IntVar(&inputAbuse, "inputabuse", 100, "disconnect client after this many dropped inputs (rate exceeded, unknown button) within -inputwindow")
+	flag.DurationVar(&inputAbuseWindow, "inputwindow", 10*time.Second, "sliding window for counting dropped inputs, see -inputabuse")
+	flag.IntVar(&profiles, "profiles", 10000, "maximum stored player profiles, least recently seen is evicted")
+	flag.StringVar(&metricsAddr, "metrics", "", "Prometheus metrics HTTP listen address, e.g. :9100 (empty disables metrics)")
 
 	flag.Parse()
 
-	w := world{
-		playerTab:      []*player{},
-		playerAdd:      make(chan *player),
-		playerDel:      make(chan *player),
-		updateInterval: 1000 * time.Millisecond,
-		input:          make(chan inputMsg),
+	cfg, errConfig := loadConfig(configFile)
+	if errConfig != nil {
+		log.Printf("main: %v", errConfig)
+		return
+	}
+	log.Printf("config: %+v", cfg)
+
+	s := &server{
+		rooms:            map[string]*world{},
+		config:           cfg,
+		clock:            clock.Real,
+		resumeGrace:      grace,
+		maxRooms:         maxRooms,
+		roomIdle:         roomIdle,
+		lagMax:           lagMax,
+		writeTimeout:     writeTimeout,
+		inputRate:        inputRate,
+		inputBurst:       inputBurst,
+		inputMax:         inputMax,
+		inputAbuse:       inputAbuse,
+		inputAbuseWindow: inputAbuseWindow,
+		profiles:         newProfileStore(profiles),
 	}
 
-	cannon := "assets/ship.png"
+	cannon := cfg.CannonImage
 	var errCanSz error
-	w.cannonWidth, w.cannonHeight, errCanSz = loadSize(cannon, unit.ScaleCannon)
+	s.cannonWidth, s.cannonHeight, s.cannonMask, errCanSz = loadSprite(cannon, unit.ScaleCannon)
 	if errCanSz != nil {
 		log.Printf("collision will NOT work: %v", errCanSz)
 	}
-	log.Printf("cannon: %s: %vx%v", cannon, w.cannonWidth, w.cannonHeight)
+	log.Printf("cannon: %s: %vx%v", cannon, s.cannonWidth, s.cannonHeight)
 
-	missile := "assets/rocket.png"
+	missile := cfg.MissileImage
 	var errMisSz error
-	w.missileWidth, w.missileHeight, errMisSz = loadSize(missile, unit.ScaleMissile)
+	s.missileWidth, s.missileHeight, s.missileMask, errMisSz = loadSprite(missile, unit.ScaleMissile)
 	if errMisSz != nil {
 		log.Printf("collision will NOT work: %v", errMisSz)
 	}
-	log.Printf("missile: %s: %vx%v", missile, w.missileWidth, w.missileHeight)
+	log.Printf("missile: %s: %vx%v", missile, s.missileWidth, s.missileHeight)
 
-	if errListen := listenAndServe(&w, addr); errListen != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelOnSignal(cancel)
+
+	if errListen := listenAndServe(ctx, s, addr); errListen != nil {
 		log.Printf("main: listen: %v", errListen)
 		return
 	}
 
-	if errDisc := lanDiscovery(addr); errDisc != nil {
+	if wsAddr != "" {
+		if errListen := listenAndServeWebSocket(ctx, s, wsAddr); errListen != nil {
+			log.Printf("main: websocket listen: %v", errListen)
+			return
+		}
+	}
+
+	if errDisc := lanDiscovery(ctx, s, addr); errDisc != nil {
 		log.Printf("main: discovery: %v", errDisc)
 		return
 	}
 
-	missileID := 0
-	cannonID := 0
+	if adminAddr != "" {
+		if errListen := listenAndServeAdmin(ctx, s, adminAddr); errListen != nil {
+			log.Printf("main: admin listen: %v", errListen)
+			return
+		}
+	}
+
+	if metricsAddr != "" {
+		if errListen := listenAndServeMetrics(ctx, s, metricsAddr); errListen != nil {
+			log.Printf("main: metrics listen: %v", errListen)
+			return
+		}
+	}
+
+	reloadOnSignal(s, configFile)
+
+	log.Printf("main: serving rooms: max=%d idle=%v", maxRooms, roomIdle)
+	s.collectRooms(ctx)
+
+	s.shutdown(drain)
+	log.Printf("main: exiting")
+}
+
+// serve runs the room service loop, until the room is removed.
+// All time readings come from w.clock, thus a fake clock can drive the loop.
+// The world is stepped at the time of its next event, see sim.NextEvent,
+// while the update ticker drives housekeeping only: updates are sent when the world changes,
+// and clients extrapolate motion and countdowns from Update.Now.
+func serve(w *world) {
+	tickerUpdate := w.clock.NewTicker(w.updateInterval)
+	var stepTimer clock.Timer
+	var stepC <-chan time.Time // nil while no step is scheduled
+	var stepAt, lastStep time.Time
+	defer func() {
+		// ticker is replaced on config reload, timer on every schedule
+		tickerUpdate.Stop()
+		if stepTimer != nil {
+			stepTimer.Stop()
+		}
+	}()
+
+	// retick replaces update ticker if its interval differs from the previous one
+	retick := func(updateInterval time.Duration) {
+		if w.updateInterval != updateInterval {
+			tickerUpdate.Stop()
+			tickerUpdate = w.clock.NewTicker(w.updateInterval)
+		}
+	}
+
+	// schedule arms the step timer for the next world event,
+	// no sooner than stepInterval after the last scheduled step.
+	schedule := func(now time.Time) {
+		next, found := w.sim.NextEvent(now)
+		if found {
+			if earliest := lastStep.Add(w.stepInterval); next.Before(earliest) {
+				next = earliest
+			}
+		}
+		if found && next.Equal(stepAt) {
+			return // unchanged
+		}
+		if stepTimer != nil {
+			stepTimer.Stop()
+		}
+		stepTimer, stepC, stepAt = nil, nil, time.Time{}
+		if !found {
+			return
+		}
+		stepAt = next
+		stepTimer = w.clock.NewTimer(next.Sub(now))
+		stepC = stepTimer.C()
+	}
 
-	tickerUpdate := time.NewTicker(w.updateInterval)
-	tickerCollision := time.NewTicker(100 * time.Millisecond)
+	// dirty means trajectories may have changed, thus the next event must be recomputed.
+	// NextEvent checks every pair of items, thus inputs leaving the world unchanged skip it.
+	dirty := true
 
-	log.Printf("main: entering service loop")
 SERVICE:
 	for {
+		if dirty {
+			schedule(w.clock.Now())
+			dirty = false
+		}
+
 		select {
+		case <-w.quit:
+			dropDetached(w, w.clock.Now())
+			log.Printf("room %s: service loop exiting", w.room)
+			return
 		case p := <-w.playerAdd:
-			p.team = 0
-			if w.teams[0].count > w.teams[1].count {
-				p.team = 1
+			now := w.clock.Now()
+			welcome := newWelcome()
+			welcome.Rules = w.sim.Rules()
+			if p.spectator {
+				if p.name == "" {
+					p.name = "spectator"
+				}
+				w.playerTab = append(w.playerTab, p)
+				p.joined <- welcome
+				log.Printf("spectator add: %v", p)
+				updateWorld(w, now, false) // first update for spectator
+				continue SERVICE
+			}
+			if resume(w, p, now) {
+				welcome.Resumed = true
+				log.Printf("player resume: %v name=%s id=%d team=%d", p, p.name, p.id, p.team)
+			} else {
+				p.resumeToken = newResumeToken()
+				p.profile = login(w, p)
+				enqueue(w, p)
+				matchmake(w, now)
 			}
-			log.Printf("player add: %v team=%d team0=%d team1=%d", p, p.team, w.teams[0].count, w.teams[1].count)
+			welcome.ResumeToken = p.resumeToken
 			w.playerTab = append(w.playerTab, p)
-
-			playerFuelSet(p, time.Now(), 5) // reset fuel to 50%
-			p.cannonStart = p.fuelStart
-			p.cannonSpeed = float32(.15) // 15%
-			p.cannonCoordX = .5          // 50%
-			p.cannonID = cannonID
-			p.cannonLife = 1 // 100%
-			cannonID++
-			w.teams[p.team].count++
+			p.joined <- welcome
+			log.Printf("player add: %v name=%s id=%d team=%d team0=%d team1=%d queue=%d", p, p.name, p.id, p.team, w.sim.TeamCount(0), w.sim.TeamCount(1), len(w.queue))
+			updateWorld(w, now, false) // new cannon, maybe round start
+			dirty = true
 		case p := <-w.playerDel:
-			log.Printf("player del: %v team=%d team0=%d team1=%d", p, p.team, w.teams[0].count, w.teams[1].count)
-			for i, pl := range w.playerTab {
-				if pl == p {
-					//w.playerTab = append(w.playerTab[:i], w.playerTab[i+1:]...)
-					if i < len(w.playerTab)-1 {
-						w.playerTab[i] = w.playerTab[len(w.playerTab)-1]
-					}
-					w.playerTab = w.playerTab[:len(w.playerTab)-1]
-					w.teams[p.team].count--
-					log.Printf("player removed: %v", p)
-					continue SERVICE
-				}
+			log.Printf("player del: %v id=%d team=%d team0=%d team1=%d", p, p.id, p.team, w.sim.TeamCount(0), w.sim.TeamCount(1))
+			if p.replaced {
+				log.Printf("player replaced by new connection: %v", p)
+				continue SERVICE
+			}
+			if !removePlayerTab(w, p) {
+				log.Printf("player not found: %v", p)
+				continue SERVICE
+			}
+			if p.spectator {
+				log.Printf("spectator removed: %v", p)
+				continue SERVICE
 			}
-			log.Printf("player not found: %v", p)
+			if dequeue(w, p) {
+				now := w.clock.Now()
+				unqueue(w, p, now)
+				log.Printf("queued player removed: %v queue=%d", p, len(w.queue))
+				updateWorld(w, now, false) // queue positions moved
+				continue SERVICE
+			}
+			now := w.clock.Now()
+			if detach(w, p, now) {
+				log.Printf("player detached: %v grace=%v", p, w.resumeGrace)
+				updateWorld(w, now, false) // cannon frozen
+				dirty = true
+				continue SERVICE
+			}
+			logout(w, p, now)
+			w.sim.RemovePlayer(p.id)
+			log.Printf("player removed: %v", p)
+			matchmake(w, now)          // backfill
+			updateWorld(w, now, false) // cannon gone, maybe round end
+			dirty = true
 		case i := <-w.input:
 			//log.Printf("input: %v", i)
 
+			if i.player.replaced {
+				continue SERVICE // stale input from old connection
+			}
+
 			switch m := i.msg.(type) {
+			case msg.Ack:
+				if !i.player.delta.ack(m.Seq) {
+					log.Printf("input ack: %v ignored seq=%d acked=%d", i.player, m.Seq, i.player.delta.acked)
+				}
 			case msg.Button:
 				log.Printf("input button: %v", m)
 
-				if i.player.cannonLife <= 0 {
-					continue // cannon destroyed
-				}
-
-				if m.ID == msg.ButtonTurn {
-					p := i.player
-					updateCannon(p, time.Now())
-					p.cannonSpeed = -p.cannonSpeed
-					updateWorld(&w, false)
+				if i.player.spectator || i.player.queued {
+					log.Printf("input button: %v owns no cannon, ignoring", i.player)
 					continue SERVICE
 				}
 
-				now := time.Now()
-				fuel := playerFuel(i.player, now)
-
-				if m.ID != msg.ButtonFire {
-					continue SERVICE // non-fire button
-				}
-
-				if fuel < 1 {
-					continue SERVICE // not enough fuel
+				now := w.clock.Now()
+				update, fire := w.sim.ApplyButton(i.player.id, m, now)
+				if fire {
+					log.Printf("input fire - missiles=%d", w.sim.Missiles())
 				}
-
-				playerFuelConsume(i.player, now, 1)
-
-				updateCannon(i.player, now)
-				miss1 := &msg.Missile{
-					ID:     missileID,
-					CoordX: i.player.cannonCoordX,
-					Speed:  .5, // 50% every 1 second
-					Team:   i.player.team,
-					Start:  now,
+				if update {
+					updateWorld(w, now, fire)
+					dirty = true // hit, turn or fire
 				}
-				missileID++
-				w.missileList = append(w.missileList, miss1)
-
-				log.Printf("input fire - fuel was=%v is=%v missiles=%d", fuel, playerFuel(i.player, now), len(w.missileList))
-
-				updateWorld(&w, true)
+			default:
+				log.Printf("input: %v unexpected message: %T", i.player, m)
 			}
 
-		case <-tickerUpdate.C:
+		case cfg := <-w.reload:
+			now := w.clock.Now()
+			updateInterval := w.updateInterval
+			applyConfig(w, cfg, now)
+			matchmake(w, now) // team size may have changed
+			retick(updateInterval)
+			updateWorld(w, now, false) // broadcast new interval and rules
+			dirty = true
+		case cmd := <-w.admin:
+			now := w.clock.Now()
+			updateInterval := w.updateInterval
+			cmd.reply <- cmd.run(w, now)
+			retick(updateInterval)
+			dirty = true // e.g. kick, pause
+		case t := <-tickerUpdate.C():
 			//log.Printf("tick: %v", t)
 
-			updateWorld(&w, false)
-		case <-tickerCollision.C:
-			if detectCollision(&w, time.Now()) {
-				updateWorld(&w, false)
+			now := w.clock.Now()
+			w.lag = now.Sub(t)
+			expired := expireDetached(w, now)
+			if matchmake(w, now) || expired { // backfill expired cannons
+				updateWorld(w, now, false)
+				dirty = true
 			}
+		case t := <-stepC:
+			now := w.clock.Now()
+			w.lag = now.Sub(t)
+			stepTimer, stepC, stepAt = nil, nil, time.Time{} // fired
+			lastStep = now
+			updateWorld(w, now, false) // every event changes the world
+			dirty = true
 		}
 	}
 }
 
-func loadSize(name string, scale float64) (float64, float64, error) {
+// collisionMaskSize is the sprite mask resolution, see unit.NewMask.
+const collisionMaskSize = 32
+
+// loadSprite returns the sprite box size and its alpha mask for pixel accurate collision.
+// On error, the mask is nil, thus collision uses a bogus box.
+func loadSprite(name string, scale float64) (float64, float64, *unit.Mask, error) {
 	bogus := image.Rect(0, 0, 10, 10)
 	w, h := unit.BoxSize(bogus, scale)
 
 	f, errOpen := os.Open(name)
 	if errOpen != nil {
-		return w, h, fmt.Errorf("loadSize: open: %s: %v", name, errOpen)
+		return w, h, nil, fmt.Errorf("loadSprite: open: %s: %v", name, errOpen)
 	}
 	defer f.Close()
 	img, _, errDec := image.Decode(f)
 	if errDec != nil {
-		return w, h, fmt.Errorf("loadSize: decode: %s: %v", name, errDec)
+		return w, h, nil, fmt.Errorf("loadSprite: decode: %s: %v", name, errDec)
 	}
 	i, ok := img.(*image.NRGBA)
 	if !ok {
-		return w, h, fmt.Errorf("loadSize: %s: not NRGBA", name)
+		return w, h, nil, fmt.Errorf("loadSprite: %s: not NRGBA", name)
 	}
 
 	w, h = unit.BoxSize(i, scale)
 	b := i.Bounds()
+	mask := unit.NewMask(i, collisionMaskSize)
 
-	log.Printf("loadSize: %s: %vx%v => %vx%v", name, b.Max.X, b.Max.Y, w, h)
-
-	return w, h, nil
-}
+	log.Printf("loadSprite: %s: %vx%v => %vx%v opaque=%.0f%%", name, b.Max.X, b.Max.Y, w, h, 100*mask.Coverage())
 
-func updateCannon(p *player, now time.Time) {
-	p.cannonCoordX, p.cannonSpeed = future.CannonX(p.cannonCoordX, p.cannonSpeed, time.Since(p.cannonStart))
-	p.cannonStart = now
+	return w, h, mask, nil
 }
 
-func removeMissile(w *world, i int) {
-	last := len(w.missileList) - 1
-	if i < last {
-		w.missileList[i] = w.missileList[last]
+func removePlayerTab(w *world, p *player) bool {
+	for i, pl := range w.playerTab {
+		if pl == p {
+			//w.playerTab = append(w.playerTab[:i], w.playerTab[i+1:]...)
+			if i < len(w.playerTab)-1 {
+				w.playerTab[i] = w.playerTab[len(w.playerTab)-1]
+			}
+			w.playerTab = w.playerTab[:len(w.playerTab)-1]
+			return true
+		}
 	}
-	w.missileList = w.missileList[:last]
+	return false
 }
 
-func updateWorld(w *world, fire bool) {
-	now := time.Now()
-
-	for _, p := range w.playerTab {
-		updateCannon(p, now)
+func updateWorld(w *world, now time.Time, fire bool) {
+	phase, _, _ := w.sim.Match()
+	w.sim.Step(now)
+	if p, round, winner := w.sim.Match(); p != phase {
+		log.Printf("room %s: match: phase=%d round=%d winner=%d scores=%v", w.room, p, round, winner, w.sim.Scores())
 	}
-
-	for i := 0; i < len(w.missileList); i++ {
-		m := w.missileList[i]
-		m.CoordY = future.MissileY(m.CoordY, m.Speed, time.Since(m.Start))
-		m.Start = now
-		if m.CoordY >= 1 {
-			removeMissile(w, i)
-			i--
-		}
+	intercepts := w.sim.Intercepts()
+	if len(intercepts) > 0 {
+		log.Printf("room %s: intercepts=%d missiles=%d", w.room, len(intercepts), w.sim.Missiles())
 	}
 
 	for _, p := range w.playerTab {
-		sendUpdatesToPlayer(w, p, now, fire)
+		sendUpdatesToPlayer(w, p, now, fire, intercepts)
 	}
 }
 
-func playerFuel(p *player, now time.Time) float32 {
-	return future.Fuel(0, now.Sub(p.fuelStart))
-}
-
-func playerFuelSet(p *player, now time.Time, fuel float32) {
-	p.fuelStart = now.Add(-time.Duration(float32(time.Second) * fuel / future.FuelRechargeRate))
-}
-
-func playerFuelConsume(p *player, now time.Time, amount float32) {
-	fuel := playerFuel(p, now)
-	playerFuelSet(p, now, fuel-amount)
-}
-
-func sendUpdatesToPlayer(w *world, p *player, now time.Time, fire bool) {
-	update := msg.Update{
-		Fuel:          playerFuel(p, now),
-		Interval:      w.updateInterval,
-		WorldMissiles: w.missileList,
-		Team:          p.team,
-		Scores:        [2]int{w.teams[0].score, w.teams[1].score},
-		FireSound:     fire,
-	}
-
-	for _, p1 := range w.playerTab {
-		cannon := msg.Cannon{
-			ID:     p1.cannonID,
-			Start:  p1.cannonStart,
-			CoordX: p1.cannonCoordX,
-			Speed:  p1.cannonSpeed,
-			Team:   p1.team,
-			Life:   p1.cannonLife,
-			Player: p1 == p,
+func sendUpdatesToPlayer(w *world, p *player, now time.Time, fire bool, intercepts []*msg.Intercept) {
+	var update msg.Update
+	if p.spectator || p.queued {
+		update = w.sim.Spectate(now)
+		update.Queued = queuePosition(w, p)
+	} else {
+		var found bool
+		update, found = w.sim.Snapshot(p.id, now)
+		if !found {
+			log.Printf("sendUpdatesToPlayer: player not found: %v", p)
+			return
 		}
-		update.Cannons = append(update.Cannons, &cannon)
+	}
+	update.Interval = w.updateInterval
+	update.FireSound = fire
+	update.Notice = w.notice
+	update.Intercepts = intercepts
+	p.delta.encode(&update)
+	if update.Full || p.rulesVersion != w.rulesVersion {
+		rules := w.sim.Rules()
+		update.Rules = &rules
+		p.rulesVersion = w.rulesVersion
 	}
 
 	//log.Printf("sending updates to player %v", p)
 
-	p.output <- update
+	sendUpdate(w, p, update, now)
 }
 
-func listenAndServe(w *world, addr string) error {
+// listenAndServe accepts clients until the context is canceled.
+func listenAndServe(ctx context.Context, s *server, addr string) error {
 
 	proto := "tcp"
 
@@ -314,52 +521,110 @@ func listenAndServe(w *world, addr string) error {
 		return fmt.Errorf("listenAndServe: %s: %v", addr, errListen)
 	}
 
-	gob.Register(msg.Update{})
-	gob.Register(msg.Button{})
+	go func() {
+		<-ctx.Done()
+		listener.Close() // stop accept loop
+	}()
 
 	go func() {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
-				log.Printf("count=%d accept on TCP %s: %s", atomic.LoadInt32(&w.countConn), addr, err)
-				conn.Close()
+				if ctx.Err() != nil {
+					log.Printf("listenAndServe: %s: stopped", addr)
+					return
+				}
+				log.Printf("count=%d accept on TCP %s: %s", atomic.LoadInt32(&s.countConn), addr, err)
+				time.Sleep(100 * time.Millisecond) // do not spin on persistent error
 				continue
 			}
-			c, _ := conn.(*net.TCPConn)
-			go connHandler(w, c)
+			go connHandler(s, conn)
 		}
 	}()
 
 	return nil
 }
 
-func connHandler(w *world, conn *net.TCPConn) {
-	count := atomic.AddInt32(&w.countConn, 1)
+func connHandler(s *server, conn net.Conn) {
+	count := atomic.AddInt32(&s.countConn, 1)
 	log.Printf("count=%d connHandler %v", count, conn.RemoteAddr())
 
 	defer func() {
-		c := atomic.AddInt32(&w.countConn, -1)
+		c := atomic.AddInt32(&s.countConn, -1)
 		log.Printf("count=%d connHandler exiting: %v", c, conn.RemoteAddr())
 		conn.Close()
 	}()
 
+	// handshake uses the codec chosen by the preamble, then switch to negotiated codec.
+	// gob decoder reads from limitReader without further buffering,
+	// thus codec decoder can continue from the same reader.
+	br := bufio.NewReader(conn)
+	r := newLimitReader(br, s.inputMax)
+	sent := &countWriter{w: conn}
+
+	hello, hsEnc, errHello := handshake(conn, br, r, sent)
+	if errHello != nil {
+		log.Printf("handler: %v: %v", conn.RemoteAddr(), errHello)
+		return
+	}
+
+	if hello.ListRooms {
+		welcome := newWelcome()
+		welcome.Rooms = s.roomList()
+		if err := hsEnc.Encode(welcome); err != nil {
+			log.Printf("handler: %v: Encode room list: %v", conn.RemoteAddr(), err)
+		}
+		return
+	}
+
+	w, errJoin := s.join(hello.Room)
+	if errJoin != nil {
+		log.Printf("handler: %v: %v", conn.RemoteAddr(), errRefuse(hsEnc, errJoin.Error()))
+		return
+	}
+	defer s.leave(w)
+
+	codec := msg.NegotiateCodec(hello.Codecs)
+	dec := codec.NewDecoderLimit(r, s.inputMax)
+	enc := codec.NewEncoder(sent)
+
 	p := &player{
-		conn:   conn,
-		output: make(chan msg.Update),
+		conn:        conn,
+		output:      newOutput(),
+		playerID:    hello.PlayerID,
+		name:        hello.Name,
+		resumeToken: hello.ResumeToken,
+		joined:      make(chan msg.Welcome, 1),
+		spectator:   hello.Spectator,
+		room:        w.room,
 	}
 
 	w.playerAdd <- p // register player
 	quitWriter := make(chan struct{})
 
+	var written int64 // last update seq written, acks beyond it are bogus
+
 	go func() {
 		// copy from socket into input channel
-		dec := gob.NewDecoder(conn)
+		filter := newInputFilter(s, &written, time.Now())
 		for {
-			var m msg.Button
-			if err := dec.Decode(&m); err != nil {
-				log.Printf("handler: Decode: %v", err)
+			r.reset()
+			m, err := dec.Decode()
+			if err != nil {
+				if err == errInputTooBig || errors.Is(err, msg.ErrFrameTooBig) {
+					atomic.AddInt64(&s.metrics.abusive, 1)
+				}
+				log.Printf("handler: %v: Decode: %v", conn.RemoteAddr(), err)
+				break
+			}
+			accept, errAbuse := filter.check(m, time.Now())
+			if errAbuse != nil {
+				log.Printf("handler: %v: disconnecting: %v", conn.RemoteAddr(), errAbuse)
 				break
 			}
+			if !accept {
+				continue
+			}
 			w.input <- inputMsg{player: p, msg: m}
 		}
 		close(quitWriter) // send quit request to output goroutine
@@ -367,20 +632,59 @@ func connHandler(w *world, conn *net.TCPConn) {
 	}()
 
 	// copy from output channel into socket
-	enc := gob.NewEncoder(conn)
+	welcome := <-p.joined
+	welcome.Codec = codec.Name()
+	welcome.Room = w.room
+	welcome.Rooms = s.roomList()
+	if err := hsEnc.Encode(welcome); err != nil {
+		log.Printf("handler: Encode welcome: %v", err)
+		conn.Close() // force reader exit, then quit request
+	}
 LOOP:
 	for {
 		select {
 		case <-quitWriter:
 			log.Printf("handler: quit request")
+			select {
+			case u := <-p.output:
+				writeUpdate(s, conn, enc, sent, &written, u) // flush last update, e.g. on shutdown
+			default:
+			}
 			break LOOP
-		case m := <-p.output:
-			if err := enc.Encode(&m); err != nil {
+		case u := <-p.output:
+			if err := writeUpdate(s, conn, enc, sent, &written, u); err != nil {
 				log.Printf("handler: Encode: %v", err)
 				break LOOP
 			}
 		}
 	}
 	w.playerDel <- p // deregister player
-	log.Printf("handler: writer goroutine exiting")
+	log.Printf("handler: writer goroutine exiting: codec=%s sent=%d bytes", codec.Name(), sent.n)
+}
+
+// writeUpdate encodes the update within the write timeout.
+// The seq is published before writing, thus the reader accepts the ack even if it arrives first.
+func writeUpdate(s *server, conn net.Conn, enc msg.Encoder, sent *countWriter, written *int64, u msg.Update) error {
+	atomic.StoreInt64(written, int64(u.Seq))
+	if err := conn.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil {
+		return err
+	}
+	begin, before := time.Now(), sent.n
+	if err := enc.Encode(u); err != nil {
+		return err
+	}
+	s.metrics.encoded(time.Since(begin), sent.n-before)
+	return nil
+}
+
+// countWriter counts bytes written.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+func TestSpectator(t *testing.T) {
+	s, w, clk := newAdminServer()
+	go serve(w)
+	defer close(w.quit)
+
+	p, _ := joinAdmin(w, "player1") // cannon 0, the zero id of spectator
+
+	type roomState struct {
+		teams    [2]int
+		missiles int
+		speed    float32
+	}
+	state := func() roomState {
+		var st roomState
+		s.adminRun(w.room, clk.Now().Add(time.Hour), func(w *world, now time.Time) string {
+			st = roomState{teams: [2]int{w.sim.TeamCount(0), w.sim.TeamCount(1)}, missiles: w.sim.Missiles()}
+			u, _ := w.sim.Snapshot(p.id, now)
+			for _, c := range u.Cannons {
+				if c.ID == p.id {
+					st.speed = c.Speed
+				}
+			}
+			return ""
+		})
+		return st
+	}
+	before := state()
+
+	spec := &player{
+		output:    newOutput(),
+		name:      "watcher",
+		joined:    make(chan msg.Welcome, 1),
+		spectator: true,
+		room:      w.room,
+	}
+	w.playerAdd <- spec
+	<-spec.joined
+
+	if u := <-spec.output; u.Team != msg.TeamSpectator || len(u.Cannons) != 1 {
+		t.Errorf("spectator first update: team=%d cannons=%d", u.Team, len(u.Cannons))
+	}
+	if st := state(); st != before {
+		t.Errorf("spectator join changed room: before=%+v after=%+v", before, st)
+	}
+
+	w.input <- inputMsg{player: spec, msg: msg.Button{ID: msg.ButtonFire}}
+	w.input <- inputMsg{player: spec, msg: msg.Button{ID: msg.ButtonTurn}}
+
+	if st := state(); st != before {
+		t.Errorf("spectator input reached world: before=%+v after=%+v", before, st)
+	}
+	select {
+	case u := <-spec.output:
+		t.Errorf("update after spectator input: seq=%d", u.Seq)
+	default:
+	}
+}
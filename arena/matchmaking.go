@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Matchmaking is enabled by config team_size.
+// Connecting players wait in the room queue, watching the match like spectators,
+// until a team has a free slot. A round starts when both teams are full,
+// and players leaving are backfilled from the queue.
+
+// enqueue puts the player in the matchmaking queue.
+func enqueue(w *world, p *player) {
+	p.queued = true
+	w.queue = append(w.queue, p)
+}
+
+// dequeue removes the player from the matchmaking queue.
+// It returns false if the player is not queued.
+func dequeue(w *world, p *player) bool {
+	for i, q := range w.queue {
+		if q == p {
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			p.queued = false
+			return true
+		}
+	}
+	return false
+}
+
+// queuePosition returns the player position in the queue, 1 is next. 0 if not queued.
+func queuePosition(w *world, p *player) int {
+	for i, q := range w.queue {
+		if q == p {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// matchmake moves queued players into teams with free slots.
+// Without team size, everybody in the queue joins.
+// It returns true if any player joined a team.
+func matchmake(w *world, now time.Time) bool {
+	size := w.config.TeamSize
+	joined := false
+	for len(w.queue) > 0 {
+		if size > 0 && w.sim.TeamCount(0) >= size && w.sim.TeamCount(1) >= size {
+			break // teams full
+		}
+		p := w.queue[0]
+		dequeue(w, p)
+		p.id, p.team = w.sim.AddPlayer(now, preferredTeam(w, p)) // smaller team, thus the one with free slot
+		log.Printf("matchmake: %v team=%d team0=%d team1=%d queue=%d", p, p.team, w.sim.TeamCount(0), w.sim.TeamCount(1), len(w.queue))
+		joined = true
+	}
+	return joined
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/clock"
+)
+
+// newMatchWorld creates a room with matchmaking for teams of size.
+func newMatchWorld(size int) (*world, *clock.Fake) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	cfg := defaultConfig()
+	cfg.TeamSize = size
+	s := &server{clock: clk, config: cfg, resumeGrace: 30 * time.Second, profiles: newProfileStore(10)}
+	return newWorld(s, "test"), clk
+}
+
+// joinQueue connects a player like the service loop does.
+func joinQueue(w *world, id string, now time.Time) *player {
+	p := &player{playerID: id, resumeToken: "token-" + id}
+	p.profile = login(w, p)
+	enqueue(w, p)
+	matchmake(w, now)
+	return p
+}
+
+func TestMatchmakeQueue(t *testing.T) {
+	w, clk := newMatchWorld(1)
+	now := clk.Now()
+
+	p1 := joinQueue(w, "p1", now)
+	p2 := joinQueue(w, "p2", now)
+	p3 := joinQueue(w, "p3", now)
+	p4 := joinQueue(w, "p4", now)
+
+	if p1.queued || p2.queued || p1.team == p2.team {
+		t.Errorf("first players not in opposing teams: p1 queued=%v team=%d p2 queued=%v team=%d", p1.queued, p1.team, p2.queued, p2.team)
+	}
+	if w.sim.TeamCount(0) != 1 || w.sim.TeamCount(1) != 1 {
+		t.Errorf("teams beyond size: team0=%d team1=%d", w.sim.TeamCount(0), w.sim.TeamCount(1))
+	}
+	if !p3.queued || !p4.queued || queuePosition(w, p3) != 1 || queuePosition(w, p4) != 2 {
+		t.Errorf("queue positions: p3=%d p4=%d", queuePosition(w, p3), queuePosition(w, p4))
+	}
+	if queuePosition(w, p1) != 0 {
+		t.Errorf("playing player in queue: position=%d", queuePosition(w, p1))
+	}
+	if matchmake(w, now) {
+		t.Errorf("matchmake with full teams reported a join")
+	}
+
+	// p4 leaves the queue, nobody joins
+	if !dequeue(w, p4) || dequeue(w, p4) {
+		t.Errorf("dequeue: expected true once")
+	}
+	if p4.queued || queuePosition(w, p3) != 1 || len(w.queue) != 1 {
+		t.Errorf("after dequeue: p4 queued=%v p3 position=%d queue=%d", p4.queued, queuePosition(w, p3), len(w.queue))
+	}
+}
+
+func TestMatchmakeBackfill(t *testing.T) {
+	for _, detached := range []bool{false, true} {
+		w, clk := newMatchWorld(1)
+		p1 := joinQueue(w, "p1", clk.Now())
+		joinQueue(w, "p2", clk.Now())
+		p3 := joinQueue(w, "p3", clk.Now())
+
+		if detached {
+			// cannon kept during grace, then expires
+			if !detach(w, p1, clk.Now()) {
+				t.Fatalf("player not detached")
+			}
+			if matchmake(w, clk.Now()) || !p3.queued {
+				t.Errorf("detached: backfill during grace")
+			}
+			clk.Advance(w.resumeGrace)
+			if !expireDetached(w, clk.Now()) {
+				t.Errorf("detached: cannon not expired")
+			}
+		} else {
+			logout(w, p1, clk.Now())
+			w.sim.RemovePlayer(p1.id)
+		}
+
+		if !matchmake(w, clk.Now()) {
+			t.Errorf("detached=%v: matchmake reported no join", detached)
+		}
+		if p3.queued || p3.team != p1.team || len(w.queue) != 0 {
+			t.Errorf("detached=%v: backfill: queued=%v team=%d expected team=%d queue=%d", detached, p3.queued, p3.team, p1.team, len(w.queue))
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metrics are counters shared by connection handlers, updated atomically.
+// int64 fields come first to keep them aligned for atomic access on 32-bit platforms.
+type metrics struct {
+	updatesSent int64 // updates encoded to clients
+	bytesSent   int64 // bytes of encoded updates
+	encodeNanos int64 // time spent encoding and writing updates
+
+	updatesCoalesced int64 // updates replaced before the writer took them
+	laggards         int64 // clients disconnected for staying behind
+
+	inputsRateLimited int64 // inputs dropped beyond rate
+	inputsUnknown     int64 // buttons with unknown ID
+	inputsUnexpected  int64 // messages clients should not send
+	abusive           int64 // clients disconnected for bad input
+}
+
+// encoded records one update written to a client.
+func (m *metrics) encoded(d time.Duration, bytes int64) {
+	atomic.AddInt64(&m.updatesSent, 1)
+	atomic.AddInt64(&m.bytesSent, bytes)
+	atomic.AddInt64(&m.encodeNanos, int64(d))
+}
+
+// roomStats is a room snapshot taken inside the room service loop.
+type roomStats struct {
+	room       string
+	team       [2]int
+	spectators int
+	queued     int
+	missiles   int
+	scores     [2]int
+	checks     int64
+	lag        time.Duration
+	paused     bool
+}
+
+// listenAndServeMetrics exposes /metrics in Prometheus text format, until the context is canceled.
+func listenAndServeMetrics(ctx context.Context, s *server, addr string) error {
+
+	log.Printf("serving metrics on %s /metrics", addr)
+
+	listener, errListen := net.Listen("tcp", addr)
+	if errListen != nil {
+		return fmt.Errorf("listenAndServeMetrics: %s: %v", addr, errListen)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(rw, s, collectRoomStats(s))
+	})
+
+	server := &http.Server{Handler: mux}
+	go shutdownHTTP(ctx, server, metricsTimeout)
+
+	go func() {
+		errServe := server.Serve(listener)
+		log.Printf("listenAndServeMetrics: %s: %v", addr, errServe)
+	}()
+
+	return nil
+}
+
+// metricsTimeout bounds one scrape, below the default Prometheus scrape timeout.
+const metricsTimeout = 5 * time.Second
+
+// collectRoomStats takes a snapshot of every room.
+// Rooms removed meanwhile, or not replying before the scrape deadline, are skipped.
+func collectRoomStats(s *server) []roomStats {
+	var list []roomStats
+	deadline := s.clock.Now().Add(metricsTimeout)
+	for _, room := range s.roomList() {
+		var st roomStats
+		_, err := s.adminRun(room.Name, deadline, func(w *world, now time.Time) string {
+			st = roomStats{
+				room:     w.room,
+				missiles: w.sim.Missiles(),
+				scores:   w.sim.Scores(),
+				checks:   w.sim.Checks(),
+				lag:      w.lag,
+				paused:   w.sim.Paused(),
+			}
+			st.team[0] = w.sim.TeamCount(0)
+			st.team[1] = w.sim.TeamCount(1)
+			for _, p := range w.playerTab {
+				switch {
+				case p.spectator:
+					st.spectators++
+				case p.queued:
+					st.queued++
+				}
+			}
+			return ""
+		})
+		if err != nil {
+			log.Printf("metrics: %v", err)
+			continue
+		}
+		list = append(list, st)
+	}
+	return list
+}
+
+func writeMetrics(out io.Writer, s *server, rooms []roomStats) {
+	family := func(name, kind, help string) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	family("arena_connections", "gauge", "Open client connections.")
+	fmt.Fprintf(out, "arena_connections %d\n", atomic.LoadInt32(&s.countConn))
+
+	// rooms skipped by collectRoomStats are still hosted
+	s.mutex.Lock()
+	hosted := len(s.rooms)
+	s.mutex.Unlock()
+	family("arena_rooms", "gauge", "Rooms hosted.")
+	fmt.Fprintf(out, "arena_rooms %d\n", hosted)
+
+	family("arena_updates_sent_total", "counter", "Updates written to clients.")
+	fmt.Fprintf(out, "arena_updates_sent_total %d\n", atomic.LoadInt64(&s.metrics.updatesSent))
+
+	family("arena_update_bytes_total", "counter", "Bytes of updates written to clients.")
+	fmt.Fprintf(out, "arena_update_bytes_total %d\n", atomic.LoadInt64(&s.metrics.bytesSent))
+
+	family("arena_update_encode_seconds", "summary", "Time spent encoding and writing updates.")
+	fmt.Fprintf(out, "arena_update_encode_seconds_sum %f\n", time.Duration(atomic.LoadInt64(&s.metrics.encodeNanos)).Seconds())
+	fmt.Fprintf(out, "arena_update_encode_seconds_count %d\n", atomic.LoadInt64(&s.metrics.updatesSent))
+
+	family("arena_updates_coalesced_total", "counter", "Updates replaced by a newer one before written to a slow client.")
+	fmt.Fprintf(out, "arena_updates_coalesced_total %d\n", atomic.LoadInt64(&s.metrics.updatesCoalesced))
+
+	family("arena_laggards_total", "counter", "Clients disconnected for staying behind.")
+	fmt.Fprintf(out, "arena_laggards_total %d\n", atomic.LoadInt64(&s.metrics.laggards))
+
+	family("arena_inputs_rejected_total", "counter", "Client inputs dropped, by reason.")
+	fmt.Fprintf(out, "arena_inputs_rejected_total{reason=\"rate\"} %d\n", atomic.LoadInt64(&s.metrics.inputsRateLimited))
+	fmt.Fprintf(out, "arena_inputs_rejected_total{reason=\"unknown_button\"} %d\n", atomic.LoadInt64(&s.metrics.inputsUnknown))
+	fmt.Fprintf(out, "arena_inputs_rejected_total{reason=\"unexpected\"} %d\n", atomic.LoadInt64(&s.metrics.inputsUnexpected))
+
+	family("arena_abusive_total", "counter", "Clients disconnected for too many rejected inputs or oversized messages.")
+	fmt.Fprintf(out, "arena_abusive_total %d\n", atomic.LoadInt64(&s.metrics.abusive))
+
+	family("arena_players", "gauge", "Players owning a cannon, per team.")
+	for _, r := range rooms {
+		for t, n := range r.team {
+			fmt.Fprintf(out, "arena_players{room=\"%s\",team=\"%d\"} %d\n", labelEscape.Replace(r.room), t, n)
+		}
+	}
+
+	family("arena_spectators", "gauge", "Spectator clients.")
+	for _, r := range rooms {
+		fmt.Fprintf(out, "arena_spectators{room=\"%s\"} %d\n", labelEscape.Replace(r.room), r.spectators)
+	}
+
+	family("arena_queued", "gauge", "Players waiting in the matchmaking queue.")
+	for _, r := range rooms {
+		fmt.Fprintf(out, "arena_queued{room=\"%s\"} %d\n", labelEscape.Replace(r.room), r.queued)
+	}
+
+	family("arena_missiles", "gauge", "Missiles in flight.")
+	for _, r := range rooms {
+		fmt.Fprintf(out, "arena_missiles{room=\"%s\"} %d\n", labelEscape.Replace(r.room), r.missiles)
+	}
+
+	family("arena_score", "gauge", "Team score in the current round.")
+	for _, r := range rooms {
+		for t, n := range r.scores {
+			fmt.Fprintf(out, "arena_score{room=\"%s\",team=\"%d\"} %d\n", labelEscape.Replace(r.room), t, n)
+		}
+	}
+
+	family("arena_collision_checks_total", "counter", "Missile-cannon collision tests, rate gives checks per second.")
+	for _, r := range rooms {
+		fmt.Fprintf(out, "arena_collision_checks_total{room=\"%s\"} %d\n", labelEscape.Replace(r.room), r.checks)
+	}
+
+	family("arena_service_lag_seconds", "gauge", "Delay between last tick and its handling by the room service loop.")
+	for _, r := range rooms {
+		fmt.Fprintf(out, "arena_service_lag_seconds{room=\"%s\"} %f\n", labelEscape.Replace(r.room), r.lag.Seconds())
+	}
+
+	family("arena_paused", "gauge", "Room paused by admin.")
+	for _, r := range rooms {
+		paused := 0
+		if r.paused {
+			paused = 1
+		}
+		fmt.Fprintf(out, "arena_paused{room=\"%s\"} %d\n", labelEscape.Replace(r.room), paused)
+	}
+}
+
+// labelEscape escapes a label value for the Prometheus text format.
+var labelEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/clock"
+)
+
+func TestCollectRoomStatsTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := &server{clock: clk, config: defaultConfig(), profiles: newProfileStore(10), rooms: map[string]*world{}}
+
+	s.rooms["main"] = newWorld(s, "main")
+	s.rooms["stuck"] = newWorld(s, "stuck") // no service loop, never replies
+	go serve(s.rooms["main"])
+	defer close(s.rooms["main"].quit)
+
+	done := make(chan []roomStats)
+	go func() {
+		done <- collectRoomStats(s)
+	}()
+
+	for {
+		select {
+		case list := <-done:
+			if len(list) != 1 || list[0].room != "main" {
+				t.Errorf("stuck room not skipped: %+v", list)
+			}
+			var out strings.Builder
+			writeMetrics(&out, s, list)
+			if !strings.Contains(out.String(), "\narena_rooms 2\n") {
+				t.Errorf("stuck room not counted:\n%s", out.String())
+			}
+			return
+		default:
+			clk.Advance(time.Second)
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+// The player output queue holds a single update, never blocking the service loop.
+// If the writer has not taken the pending update yet, the new update replaces it:
+// only the latest snapshot matters, since deltas are based on updates acked by the client.
+// A client staying behind for lagMax is disconnected.
+
+func newOutput() chan msg.Update {
+	return make(chan msg.Update, 1)
+}
+
+// queueUpdate hands the update to the connection writer without blocking.
+// It returns false if a pending update was replaced.
+func queueUpdate(p *player, u msg.Update) bool {
+	for {
+		select {
+		case p.output <- u:
+			return true
+		default:
+		}
+		select {
+		case old := <-p.output:
+			p.output <- coalesce(old, u) // slot is free: service loop is the only sender
+			return false
+		default:
+			// writer took the pending update meanwhile, retry
+		}
+	}
+}
+
+// coalesce keeps the one-shot fields of the replaced update.
+func coalesce(old, u msg.Update) msg.Update {
+	u.FireSound = u.FireSound || old.FireSound
+	if u.Notice == "" {
+		u.Notice = old.Notice
+	}
+	if u.Rules == nil {
+		u.Rules = old.Rules
+	}
+	if len(old.Intercepts) > 0 {
+		// fresh slice: intercepts are shared by updates to all players
+		u.Intercepts = append(append([]*msg.Intercept{}, old.Intercepts...), u.Intercepts...)
+	}
+	return u
+}
+
+// sendUpdate queues the update, disconnecting the player if it stays behind for too long.
+func sendUpdate(w *world, p *player, u msg.Update, now time.Time) {
+	if queueUpdate(p, u) {
+		p.behindSince = time.Time{} // caught up
+		return
+	}
+
+	atomic.AddInt64(&w.metrics.updatesCoalesced, 1)
+
+	if p.behindSince.IsZero() {
+		p.behindSince = now
+		return
+	}
+	if p.lagging || now.Sub(p.behindSince) < w.lagMax {
+		return
+	}
+
+	p.lagging = true
+	atomic.AddInt64(&w.metrics.laggards, 1)
+	log.Printf("sendUpdate: %v behind for %v, disconnecting", p, now.Sub(p.behindSince))
+	p.conn.Close() // connection handler deregisters player
+}
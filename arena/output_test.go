@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+func TestSendUpdateCoalesce(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+
+	w := &world{lagMax: 3 * time.Second, metrics: &metrics{}}
+	p := &player{conn: conn, output: newOutput()}
+	now := time.Unix(0, 0)
+
+	// writer never reads: every update after the first replaces the pending one
+	sendUpdate(w, p, msg.Update{Seq: 1, FireSound: true, Intercepts: []*msg.Intercept{{Team: 0}}}, now)
+	sendUpdate(w, p, msg.Update{Seq: 2, Notice: "hello"}, now.Add(time.Second))
+	sendUpdate(w, p, msg.Update{Seq: 3, Intercepts: []*msg.Intercept{{Team: 1}}}, now.Add(2*time.Second))
+
+	if len(p.output) != 1 {
+		t.Fatalf("queue length: expected=1 result=%d", len(p.output))
+	}
+	u := <-p.output
+	if u.Seq != 3 || !u.FireSound || u.Notice != "hello" || len(u.Intercepts) != 2 {
+		t.Errorf("coalesced update: seq=%d fire=%v notice=%q intercepts=%d", u.Seq, u.FireSound, u.Notice, len(u.Intercepts))
+	}
+	if w.metrics.updatesCoalesced != 2 {
+		t.Errorf("coalesced count: expected=2 result=%d", w.metrics.updatesCoalesced)
+	}
+
+	// writer caught up
+	sendUpdate(w, p, msg.Update{Seq: 4}, now.Add(3*time.Second))
+	if !p.behindSince.IsZero() || p.lagging {
+		t.Errorf("caught up player: behindSince=%v lagging=%v", p.behindSince, p.lagging)
+	}
+
+	// writer stalls beyond lagMax
+	for i := 5; i < 10; i++ {
+		sendUpdate(w, p, msg.Update{Seq: i}, now.Add(time.Duration(i)*time.Second))
+	}
+	if !p.lagging {
+		t.Errorf("stalled player not disconnected")
+	}
+	if _, err := conn.Write([]byte{0}); err == nil {
+		t.Errorf("stalled player connection not closed")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+)
+
+// profile keeps player data across connections.
+type profile struct {
+	playerID string
+	name     string
+	team     int       // last team, used as preference when returning
+	stats    sim.Stats // accumulated from past connections
+	sessions int
+	lastSeen time.Time
+	online   int           // connections using the profile
+	offline  *list.Element // position in profileStore.offline, nil while online
+}
+
+// profileStore holds the profiles, keyed by persistent player ID.
+// It is shared by all rooms, thus profiles outlive removed rooms.
+// Client chosen IDs must not grow memory without limit: when full,
+// the profile offline for the longest time is evicted.
+type profileStore struct {
+	mutex    sync.Mutex // guards the store and the profiles, held by login and logout
+	max      int
+	profiles map[string]*profile
+	offline  *list.List // offline profiles, least recently seen at back
+}
+
+func newProfileStore(max int) *profileStore {
+	return &profileStore{
+		max:      max,
+		profiles: map[string]*profile{},
+		offline:  list.New(),
+	}
+}
+
+// acquire finds the profile for the player ID, creating it if missing, and marks it online.
+// Caller must hold the store mutex.
+func (s *profileStore) acquire(playerID string) (*profile, bool) {
+	prof, found := s.profiles[playerID]
+	if !found {
+		s.evict()
+		prof = &profile{
+			playerID: playerID,
+			team:     sim.AnyTeam,
+		}
+		s.profiles[playerID] = prof
+	}
+	if prof.offline != nil {
+		s.offline.Remove(prof.offline)
+		prof.offline = nil
+	}
+	prof.online++
+	return prof, found
+}
+
+// release marks the profile offline once no connection uses it.
+// Caller must hold the store mutex.
+func (s *profileStore) release(prof *profile, now time.Time) {
+	prof.lastSeen = now
+	prof.online--
+	if prof.online > 0 {
+		return
+	}
+	prof.online = 0
+	if prof.offline == nil {
+		prof.offline = s.offline.PushFront(prof)
+	}
+}
+
+// evict makes room for a new profile. Profiles online are never evicted,
+// thus the store exceeds max only while more players than max are connected.
+func (s *profileStore) evict() {
+	for len(s.profiles) >= s.max {
+		oldest := s.offline.Back()
+		if oldest == nil {
+			return // all online
+		}
+		prof := s.offline.Remove(oldest).(*profile)
+		delete(s.profiles, prof.playerID)
+		log.Printf("profile evicted: id=%s name=%s lastSeen=%v", prof.playerID, prof.name, prof.lastSeen)
+	}
+}
+
+// login finds the profile for the persistent player identity, creating it for new players.
+// Anonymous players (empty identity) get no profile.
+func login(w *world, p *player) *profile {
+	if p.playerID == "" {
+		if p.name == "" {
+			p.name = "player"
+		}
+		return nil
+	}
+
+	w.profiles.mutex.Lock()
+	defer w.profiles.mutex.Unlock()
+
+	prof, found := w.profiles.acquire(p.playerID)
+	if !found {
+		log.Printf("login: new player: id=%s", p.playerID)
+	} else {
+		log.Printf("login: returning player: id=%s name=%s team=%d sessions=%d stats=%+v", prof.playerID, prof.name, prof.team, prof.sessions, prof.stats)
+	}
+
+	switch {
+	case p.name != "":
+		prof.name = p.name // player requested new name
+	case prof.name != "":
+		p.name = prof.name // keep previous name
+	default:
+		p.name = "player"
+		prof.name = p.name
+	}
+
+	prof.sessions++
+
+	return prof
+}
+
+// logout saves the player connection data into its profile.
+func logout(w *world, p *player, now time.Time) {
+	if p.profile == nil {
+		return
+	}
+	stats, _ := w.sim.Stats(p.id)
+
+	w.profiles.mutex.Lock()
+	defer w.profiles.mutex.Unlock()
+
+	p.profile.stats = p.profile.stats.Add(stats)
+	p.profile.team = p.team
+	w.profiles.release(p.profile, now)
+	log.Printf("logout: id=%s name=%s team=%d stats=%+v", p.profile.playerID, p.profile.name, p.profile.team, p.profile.stats)
+}
+
+// preferredTeam returns the last team of the player, AnyTeam if unknown.
+func preferredTeam(w *world, p *player) int {
+	if p.profile == nil {
+		return sim.AnyTeam
+	}
+	w.profiles.mutex.Lock()
+	defer w.profiles.mutex.Unlock()
+	return p.profile.team
+}
+
+// unqueue releases the profile of a player who left the queue, thus played nothing to save.
+func unqueue(w *world, p *player, now time.Time) {
+	if p.profile == nil {
+		return
+	}
+	w.profiles.mutex.Lock()
+	defer w.profiles.mutex.Unlock()
+	w.profiles.release(p.profile, now)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/clock"
+)
+
+func TestProfileStoreEvict(t *testing.T) {
+	s := newProfileStore(2)
+	now := time.Unix(0, 0)
+
+	a, _ := s.acquire("a")
+	b, _ := s.acquire("b")
+	s.release(a, now)
+	s.release(b, now.Add(time.Second))
+
+	s.acquire("c") // full: evicts a, offline for the longest time
+	if _, found := s.profiles["a"]; found {
+		t.Errorf("least recently seen profile not evicted")
+	}
+	if _, found := s.profiles["b"]; !found {
+		t.Errorf("recent profile evicted")
+	}
+
+	// online profiles are never evicted
+	if _, found := s.acquire("b"); !found {
+		t.Errorf("returning player lost profile")
+	}
+	s.acquire("d")
+	if len(s.profiles) != 3 {
+		t.Errorf("all profiles online: expected store to exceed max: profiles=%d", len(s.profiles))
+	}
+}
+
+func TestProfileSharedByRooms(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := &server{clock: clk, config: defaultConfig(), profiles: newProfileStore(10)}
+
+	w1 := newWorld(s, "main")
+	p1 := &player{playerID: "player1", name: "alice"}
+	p1.profile = login(w1, p1)
+	p1.id, p1.team = w1.sim.AddPlayer(clk.Now(), sim.AnyTeam)
+	logout(w1, p1, clk.Now())
+
+	// the room is gone, the profile is not
+	w2 := newWorld(s, "other")
+	p2 := &player{playerID: "player1"}
+	p2.profile = login(w2, p2)
+	if p2.profile != p1.profile || p2.name != "alice" || p2.profile.sessions != 2 {
+		t.Errorf("profile lost across rooms: name=%s sessions=%d", p2.name, p2.profile.sessions)
+	}
+}
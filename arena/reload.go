@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// reloadOnSignal re-reads the config file on SIGHUP and hands it to the room service loops.
+// An invalid file is reported and ignored, thus the running rules are kept.
+func reloadOnSignal(s *server, path string) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for range sig {
+			if path == "" {
+				log.Printf("reload: SIGHUP ignored: no config file, see -config")
+				continue
+			}
+			if err := s.reload(path); err != nil {
+				log.Printf("reload: keeping current rules: %v", err)
+			}
+		}
+	}()
+}
+
+// reload re-reads the config file and hands it to the room service loops.
+// An invalid file is returned as error, leaving the rooms untouched.
+func (s *server) reload(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	log.Printf("reload: %s", path)
+	s.reloadConfig(cfg)
+	return nil
+}
+
+// applyConfig changes the running rules. It is called from the service loop.
+// Tickers are reset by the caller when intervals change.
+func applyConfig(w *world, cfg config, now time.Time) {
+	if cfg.CannonImage != w.config.CannonImage || cfg.MissileImage != w.config.MissileImage {
+		log.Printf("reload: cannon_image and missile_image changes require restart")
+	}
+
+	w.sim.SetRules(cfg.rules(), now)
+	w.sim.UpdateMatch(cfg.match())
+	w.sim.SetRespawn(time.Duration(cfg.Respawn), time.Duration(cfg.Invulnerable))
+	w.updateInterval = time.Duration(cfg.UpdateInterval)
+	w.stepInterval = time.Duration(cfg.StepInterval)
+
+	if cfg.rules() != w.config.rules() {
+		w.rulesVersion++ // resend rules to clients
+	}
+
+	w.config = cfg
+
+	log.Printf("reload: room %s: config: %+v", w.room, cfg)
+}
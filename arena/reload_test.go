@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+)
+
+func TestReload(t *testing.T) {
+	dir, errDir := ioutil.TempDir("", "arena_reload")
+	if errDir != nil {
+		t.Fatalf("tempdir: %v", errDir)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	write := func(cfg string) {
+		if err := ioutil.WriteFile(path, []byte(cfg), 0640); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := &server{clock: clk, config: defaultConfig(), profiles: newProfileStore(10), rooms: map[string]*world{}}
+	w := newWorld(s, "main")
+	s.rooms["main"] = w
+
+	p := &player{playerID: "p1", output: newOutput()}
+	p.profile = login(w, p)
+	p.id, p.team = w.sim.AddPlayer(clk.Now(), sim.AnyTeam)
+	w.playerTab = append(w.playerTab, p)
+
+	go serve(w)
+	defer close(w.quit)
+
+	type roomState struct {
+		rules          msg.Rules
+		rulesVersion   int
+		updateInterval time.Duration
+		teamSize       int
+	}
+	state := func() roomState {
+		var st roomState
+		if _, err := s.adminRun("main", clk.Now().Add(time.Hour), func(w *world, now time.Time) string {
+			st = roomState{w.sim.Rules(), w.rulesVersion, w.updateInterval, w.config.TeamSize}
+			return ""
+		}); err != nil {
+			t.Fatalf("adminRun: %v", err)
+		}
+		return st
+	}
+	before := state()
+
+	write(`{"missile_speed": 0.9, "update_interval": "2s", "team_size": 3}`)
+	if err := s.reload(path); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	after := state()
+	if after.rules.MissileSpeed != .9 || after.rulesVersion != before.rulesVersion+1 ||
+		after.updateInterval != 2*time.Second || after.teamSize != 3 {
+		t.Errorf("reloaded room: before=%+v after=%+v", before, after)
+	}
+
+	// the update broadcast by reload carries the new rules
+	u := <-p.output
+	if u.Rules == nil || u.Rules.MissileSpeed != .9 || u.Interval != 2*time.Second {
+		t.Errorf("update after reload: rules=%+v interval=%v", u.Rules, u.Interval)
+	}
+
+	write(`{"missile_speed": 0}`)
+	if err := s.reload(path); err == nil {
+		t.Errorf("invalid config accepted")
+	}
+	if st := state(); st != after {
+		t.Errorf("invalid config changed room: expected=%+v result=%+v", after, st)
+	}
+}
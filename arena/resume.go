@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+func newResumeToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("newResumeToken: %v", err)
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// resume attaches the new connection to the cannon of the same identity holding a matching token.
+// It looks first for players detached within the grace period, then for connected players
+// whose broken connection was not detected yet.
+// It returns false if there is nothing to resume.
+func resume(w *world, p *player, now time.Time) bool {
+	if p.playerID == "" || p.resumeToken == "" {
+		return false
+	}
+
+	for i, old := range w.detached {
+		if old.playerID == p.playerID && old.resumeToken == p.resumeToken {
+			w.detached = append(w.detached[:i], w.detached[i+1:]...)
+			takeOver(w, p, old, now)
+			return true
+		}
+	}
+
+	for _, old := range w.playerTab {
+		if old.queued || old.spectator {
+			continue // owns no cannon
+		}
+		if old.playerID == p.playerID && old.resumeToken == p.resumeToken {
+			removePlayerTab(w, old)
+			old.replaced = true
+			old.conn.Close() // old handler will exit
+			takeOver(w, p, old, now)
+			return true
+		}
+	}
+
+	return false
+}
+
+func takeOver(w *world, p, old *player, now time.Time) {
+	p.id = old.id
+	p.team = old.team
+	p.name = old.name
+	p.profile = old.profile
+	w.sim.Unfreeze(p.id, now)
+}
+
+// detach keeps the cannon of a disconnected player during the grace period.
+// It returns false if the player cannot be resumed, e.g. kicked.
+func detach(w *world, p *player, now time.Time) bool {
+	if p.kicked || p.profile == nil || p.resumeToken == "" || w.resumeGrace <= 0 {
+		return false
+	}
+	w.sim.Freeze(p.id, now)
+	p.detachedAt = now
+	w.detached = append(w.detached, p)
+	return true
+}
+
+// dropDetached logs out every detached player, since the room is being removed.
+// Their profiles go offline and keep the stats of the round.
+func dropDetached(w *world, now time.Time) {
+	for _, p := range w.detached {
+		log.Printf("player dropped with room: %v name=%s id=%d", p, p.name, p.id)
+		logout(w, p, now)
+		w.sim.RemovePlayer(p.id)
+	}
+	w.detached = nil
+}
+
+// expireDetached removes cannons whose grace period is over.
+// It returns true if any cannon was removed.
+func expireDetached(w *world, now time.Time) bool {
+	expired := false
+	for i := 0; i < len(w.detached); i++ {
+		p := w.detached[i]
+		if now.Sub(p.detachedAt) < w.resumeGrace {
+			continue
+		}
+		w.detached = append(w.detached[:i], w.detached[i+1:]...)
+		i--
+		log.Printf("player expired: %v name=%s id=%d", p, p.name, p.id)
+		logout(w, p, now)
+		w.sim.RemovePlayer(p.id)
+		expired = true
+	}
+	return expired
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/clock"
+)
+
+func TestResume(t *testing.T) {
+	const grace = 30 * time.Second
+
+	for _, c := range []struct {
+		name     string
+		kicked   bool
+		wait     time.Duration // between disconnect and reconnect
+		token    string        // sent on reconnect
+		detached bool          // kept for resume on disconnect
+		resumed  bool
+	}{
+		{"within grace", false, 10 * time.Second, "token", true, true},
+		{"wrong token", false, 10 * time.Second, "bogus", true, false},
+		{"grace expired", false, grace + time.Second, "token", true, false},
+		{"kicked", true, time.Second, "token", false, false},
+	} {
+		clk := clock.NewFake(time.Unix(0, 0))
+		s := &server{clock: clk, config: defaultConfig(), resumeGrace: grace, profiles: newProfileStore(10)}
+		w := newWorld(s, "test")
+
+		old := &player{playerID: "player1", resumeToken: "token", kicked: c.kicked}
+		old.profile = login(w, old)
+		old.id, old.team = w.sim.AddPlayer(clk.Now(), sim.AnyTeam)
+
+		if detached := detach(w, old, clk.Now()); detached != c.detached {
+			t.Errorf("%s: detached: expected=%v result=%v", c.name, c.detached, detached)
+		}
+
+		clk.Advance(c.wait)
+		expireDetached(w, clk.Now())
+
+		p := &player{playerID: "player1", resumeToken: c.token}
+		resumed := resume(w, p, clk.Now())
+		if resumed != c.resumed {
+			t.Errorf("%s: resumed: expected=%v result=%v", c.name, c.resumed, resumed)
+		}
+		if resumed && (p.id != old.id || p.team != old.team || p.profile != old.profile) {
+			t.Errorf("%s: resumed another cannon: id=%d team=%d, expected id=%d team=%d", c.name, p.id, p.team, old.id, old.team)
+		}
+
+		_, _, found := w.sim.Status(old.id, clk.Now())
+		if expired := c.detached && c.wait >= grace; expired == found {
+			t.Errorf("%s: cannon in world=%v after %v", c.name, found, c.wait)
+		}
+	}
+}
+
+func TestDropDetached(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := &server{clock: clk, config: defaultConfig(), resumeGrace: time.Minute, profiles: newProfileStore(1)}
+	w := newWorld(s, "test")
+
+	p := &player{playerID: "player1", resumeToken: "token"}
+	p.profile = login(w, p)
+	p.id, p.team = w.sim.AddPlayer(clk.Now(), sim.AnyTeam)
+	if !detach(w, p, clk.Now()) {
+		t.Fatalf("player not detached")
+	}
+
+	dropDetached(w, clk.Now()) // room removed within grace
+
+	if len(w.detached) != 0 || w.sim.TeamCount(p.team) != 0 {
+		t.Errorf("detached player kept: detached=%d team count=%d", len(w.detached), w.sim.TeamCount(p.team))
+	}
+	if p.profile.online != 0 {
+		t.Errorf("profile still online: %d", p.profile.online)
+	}
+
+	// offline profile can be evicted for a new player
+	s.profiles.acquire("player2")
+	if _, found := s.profiles.profiles["player1"]; found {
+		t.Errorf("dropped player profile not evicted")
+	}
+}
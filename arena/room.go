@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/udhos/fugo/arena/sim"
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+	"github.com/udhos/fugo/unit"
+)
+
+// server holds the rooms. Each room is a world served by its own goroutine.
+type server struct {
+	metrics     metrics // first field, aligned for atomic access
+	mutex       sync.Mutex
+	rooms       map[string]*world // room name => world
+	config      config            // config for rooms, replaced on reload
+	clock       clock.Clock
+	countConn   int32
+	resumeGrace time.Duration
+	maxRooms    int
+	roomIdle    time.Duration // empty room is removed after this time
+	closing     bool          // shutting down, refuse join
+
+	lagMax           time.Duration // client behind for this time is disconnected
+	writeTimeout     time.Duration // socket write deadline for one update
+	inputRate        float64       // client inputs per second, see inputFilter
+	inputBurst       int
+	inputMax         int // client message size
+	inputAbuse       int // dropped inputs tolerated per connection within inputAbuseWindow
+	inputAbuseWindow time.Duration
+	profiles         *profileStore // shared by rooms
+
+	cannonWidth   float64
+	cannonHeight  float64
+	missileWidth  float64
+	missileHeight float64
+	cannonMask    *unit.Mask // sprite alpha, see loadSprite
+	missileMask   *unit.Mask
+}
+
+// join finds the room by name, creating it if missing, and counts the client in.
+// The room is not removed while it has clients, see leave.
+func (s *server) join(name string) (*world, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closing {
+		return nil, fmt.Errorf(shutdownNotice)
+	}
+
+	w, found := s.rooms[name]
+	if !found {
+		if len(s.rooms) >= s.maxRooms {
+			return nil, fmt.Errorf("too many rooms: %d", len(s.rooms))
+		}
+		w = newWorld(s, name)
+		s.rooms[name] = w
+		go serve(w)
+		log.Printf("room created: %s rooms=%d", name, len(s.rooms))
+	}
+
+	w.clients++
+
+	return w, nil
+}
+
+// leave counts the client out of the room.
+// The client must have been deregistered from the room service loop.
+func (s *server) leave(w *world) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.clients--
+	if w.clients == 0 {
+		w.idleSince = s.clock.Now()
+	}
+}
+
+// roomList returns the rooms sorted by name.
+func (s *server) roomList() []msg.Room {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]msg.Room, 0, len(s.rooms))
+	for name, w := range s.rooms {
+		list = append(list, msg.Room{Name: name, Clients: w.clients})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// reloadConfig hands the new config to every room service loop.
+// The rooms are sent to without holding the mutex, since a busy
+// room loop would otherwise block join and leave for every room.
+func (s *server) reloadConfig(cfg config) {
+	s.mutex.Lock()
+	s.config = cfg
+	rooms := make([]*world, 0, len(s.rooms))
+	for _, w := range s.rooms {
+		rooms = append(rooms, w)
+	}
+	s.mutex.Unlock()
+
+	for _, w := range rooms {
+		select {
+		case w.reload <- cfg:
+		case <-w.quit: // room removed meanwhile
+		}
+	}
+}
+
+// collectRooms removes rooms left empty for roomIdle.
+// Detached players are logged out by the service loop on quit, see dropDetached.
+// It returns when the context is canceled.
+func (s *server) collectRooms(ctx context.Context) {
+	period := s.roomIdle / 2
+	if period < time.Second {
+		period = time.Second
+	}
+	ticker := s.clock.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		now := s.clock.Now()
+		s.mutex.Lock()
+		for name, w := range s.rooms {
+			if w.clients == 0 && now.Sub(w.idleSince) >= s.roomIdle {
+				close(w.quit) // stop room service loop
+				delete(s.rooms, name)
+				log.Printf("room removed: %s rooms=%d", name, len(s.rooms))
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// newWorld creates the room world from server config.
+// Caller must hold the server mutex.
+func newWorld(s *server, name string) *world {
+	cfg := s.config
+	w := &world{
+		room:           name,
+		playerTab:      []*player{},
+		playerAdd:      make(chan *player),
+		playerDel:      make(chan *player),
+		input:          make(chan inputMsg),
+		reload:         make(chan config),
+		admin:          make(chan adminCmd),
+		quit:           make(chan struct{}),
+		updateInterval: time.Duration(cfg.UpdateInterval),
+		stepInterval:   time.Duration(cfg.StepInterval),
+		config:         cfg,
+		clock:          s.clock,
+		profiles:       s.profiles,
+		resumeGrace:    s.resumeGrace,
+		lagMax:         s.lagMax,
+		metrics:        &s.metrics,
+		idleSince:      s.clock.Now(),
+	}
+
+	now := w.clock.Now()
+	w.sim = sim.New(s.cannonWidth, s.cannonHeight, s.missileWidth, s.missileHeight)
+	w.sim.SetMasks(s.cannonMask, s.missileMask)
+	w.sim.SetRules(cfg.rules(), now)
+	w.sim.SetMatch(cfg.match(), now)
+	w.sim.SetRespawn(time.Duration(cfg.Respawn), time.Duration(cfg.Invulnerable))
+
+	return w
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const shutdownNotice = "server shutting down"
+
+// cancelOnSignal cancels the context on SIGINT or SIGTERM, starting graceful shutdown.
+// A second signal exits immediately.
+func cancelOnSignal(cancel context.CancelFunc) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		s := <-sig
+		log.Printf("shutdown: %v: draining, send again to exit immediately", s)
+		cancel()
+		s = <-sig
+		log.Printf("shutdown: %v: exiting", s)
+		os.Exit(1)
+	}()
+}
+
+// shutdown refuses new rooms and players, notifies every player with a last update
+// carrying final scores, then waits up to drain for connections to close.
+// Listeners must have been closed by the caller.
+func (s *server) shutdown(drain time.Duration) {
+	s.mutex.Lock()
+	s.closing = true // refuse join
+	s.mutex.Unlock()
+
+	adminDeadline := s.clock.Now().Add(adminTimeout)
+	for _, room := range s.roomList() {
+		reply, err := s.adminRun(room.Name, adminDeadline, shutdownRoom)
+		if err != nil {
+			log.Printf("shutdown: %v", err)
+			continue
+		}
+		log.Printf("shutdown: %s", reply)
+	}
+
+	deadline := time.Now().Add(drain)
+	for atomic.LoadInt32(&s.countConn) > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Printf("shutdown: connections left: %d", atomic.LoadInt32(&s.countConn))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for name, w := range s.rooms {
+		close(w.quit) // stop room service loop, which logs out detached players
+		delete(s.rooms, name)
+	}
+}
+
+// shutdownHTTP closes the listener when the context is canceled,
+// then waits up to timeout for requests in flight.
+func shutdownHTTP(ctx context.Context, server *http.Server, timeout time.Duration) {
+	<-ctx.Done()
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctxShutdown); err != nil {
+		log.Printf("shutdownHTTP: %v", err)
+		server.Close()
+	}
+}
+
+// shutdownRoom sends the last update and disconnects players. It is called from the service loop.
+func shutdownRoom(w *world, now time.Time) string {
+	w.notice = shutdownNotice
+	updateWorld(w, now, false) // final scores
+	w.notice = ""
+
+	for _, p := range w.playerTab {
+		p.kicked = true // no resume
+		// the reader fails, then the writer exits after the last update
+		if err := p.conn.SetReadDeadline(time.Now()); err != nil {
+			p.conn.Close()
+		}
+	}
+
+	phase, round, winner := w.sim.Match()
+	return fmt.Sprintf("room %s: players=%d phase=%d round=%d winner=%d final scores=%v", w.room, len(w.playerTab), phase, round, winner, w.sim.Scores())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+)
+
+func TestShutdown(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	s := &server{clock: clk, config: defaultConfig(), profiles: newProfileStore(10), rooms: map[string]*world{}}
+
+	var rooms []*world
+	var exited []chan struct{}
+	for _, name := range []string{msg.DefaultRoom, "other"} {
+		w := newWorld(s, name)
+		s.rooms[name] = w
+		done := make(chan struct{})
+		go func() {
+			serve(w)
+			close(done)
+		}()
+		rooms = append(rooms, w)
+		exited = append(exited, done)
+	}
+	p, _ := joinAdmin(rooms[0], "player1")
+
+	s.shutdown(0)
+
+	if u := <-p.output; u.Notice != shutdownNotice {
+		t.Errorf("last update: notice=%q", u.Notice)
+	}
+	if !p.kicked {
+		t.Errorf("player not kicked")
+	}
+	for i, w := range rooms {
+		select {
+		case <-w.quit:
+		default:
+			t.Errorf("room %s: quit channel not closed", w.room)
+		}
+		select {
+		case <-exited[i]:
+		case <-time.After(5 * time.Second):
+			t.Errorf("room %s: service loop did not exit", w.room)
+		}
+	}
+	if len(s.rooms) != 0 {
+		t.Errorf("rooms left: %d", len(s.rooms))
+	}
+	if _, err := s.join(msg.DefaultRoom); err == nil {
+		t.Errorf("join accepted after shutdown")
+	}
+}
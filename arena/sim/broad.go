@@ -0,0 +1,110 @@
+package sim
+
+import (
+	"math"
+	"time"
+
+	"github.com/udhos/fugo/future"
+	"github.com/udhos/fugo/unit"
+)
+
+// Broad phase: cannons live on two fixed rows and missiles fly straight up or down,
+// thus only items whose extents overlap along X may collide.
+// Sweep and prune along X finds those pairs, see unit.Overlaps.
+
+// missileCannonPairs calls fn for each missile and enemy cannon alive
+// whose X extents may overlap within [from,to].
+func (w *World) missileCannonPairs(from, to time.Time, fn func(i int, p *player)) {
+	if w.bruteForce {
+		for i, m := range w.missileList {
+			for _, p := range w.playerTab {
+				if p.cannonLife > 0 && m.Team != p.team {
+					fn(i, p)
+				}
+			}
+		}
+		return
+	}
+
+	var missiles [2][]unit.Span // per team
+
+	// no contact after every missile left the field
+	end := from
+	for i, m := range w.missileList {
+		missiles[m.Team] = append(missiles[m.Team], w.missileSpan(i))
+		top := future.MissileTop(m.CoordY, m.Speed)
+		if top == future.Never {
+			end = to
+			continue
+		}
+		end = latest(end, m.Start.Add(top))
+	}
+	if end.After(to) {
+		end = to
+	}
+
+	var cannons [2][]unit.Span // per team
+	for i, p := range w.playerTab {
+		if p.cannonLife <= 0 {
+			continue
+		}
+		cannons[p.team] = append(cannons[p.team], w.cannonSpan(i, from, end))
+	}
+
+	for team := 0; team < 2; team++ {
+		unit.Overlaps(missiles[team], cannons[1-team], func(m, c unit.Span) {
+			fn(m.Index, w.playerTab[c.Index])
+		})
+	}
+}
+
+// missilePairs calls fn for each pair of opposing missiles whose X extents overlap, with i < j.
+func (w *World) missilePairs(fn func(i, j int)) {
+	if w.bruteForce {
+		for i, m1 := range w.missileList {
+			for j := i + 1; j < len(w.missileList); j++ {
+				if m1.Team != w.missileList[j].Team {
+					fn(i, j)
+				}
+			}
+		}
+		return
+	}
+
+	var missiles [2][]unit.Span // per team
+	for i, m := range w.missileList {
+		missiles[m.Team] = append(missiles[m.Team], w.missileSpan(i))
+	}
+
+	unit.Overlaps(missiles[0], missiles[1], func(a, b unit.Span) {
+		if a.Index < b.Index {
+			fn(a.Index, b.Index)
+			return
+		}
+		fn(b.Index, a.Index)
+	})
+}
+
+// missileSpan returns the X extent of missile i. Missiles never move along X.
+func (w *World) missileSpan(i int) unit.Span {
+	m := w.missileList[i]
+	r := unit.MissileBox(fieldLeft, fieldRight, float64(m.CoordX), 0, fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, w.missileWidth, w.missileHeight, m.Team == 0)
+	return unit.Span{Min: r.X1, Max: r.X2, Index: i}
+}
+
+// cannonSpan returns the X extent swept by cannon i within [from,to].
+// The cannon moves at most speed*(to-from) either way, bounded by the field.
+func (w *World) cannonSpan(i int, from, to time.Time) unit.Span {
+	p := w.playerTab[i]
+	from = latest(from, p.cannonStart)
+	x, speed := future.CannonX(p.cannonCoordX, p.cannonSpeed, from.Sub(p.cannonStart))
+	reach := math.Abs(float64(speed)) * math.Max(0, to.Sub(from).Seconds())
+	lo := math.Max(0, float64(x)-reach)
+	hi := math.Min(1, float64(x)+reach)
+	up := p.team == 0
+	return unit.Span{
+		Min:   unit.CannonBox(fieldLeft, fieldRight, lo, fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, up).X1,
+		Max:   unit.CannonBox(fieldLeft, fieldRight, hi, fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, up).X2,
+		Index: i,
+	}
+}
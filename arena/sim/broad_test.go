@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+)
+
+// newCrowdedWorld spreads cannons and missiles in flight randomly over the field.
+func newCrowdedWorld(players, missiles int, bruteForce bool) (*World, *clock.Fake) {
+	rnd := rand.New(rand.NewSource(1))
+	w := New(.1, .1, .02, .05)
+	w.bruteForce = bruteForce
+	clk := clock.NewFake(time.Unix(0, 0))
+	now := clk.Now()
+
+	rules := w.Rules()
+	rules.MissileIntercept = true
+	w.SetRules(rules, now)
+
+	for i := 0; i < players; i++ {
+		w.AddPlayer(now, AnyTeam)
+	}
+	for _, p := range w.playerTab {
+		p.cannonCoordX = rnd.Float32()
+		if rnd.Intn(2) == 0 {
+			p.cannonSpeed = -p.cannonSpeed
+		}
+		p.spawnedAt = now.Add(-w.invulnerable)
+	}
+
+	for i := 0; i < missiles; i++ {
+		m := &msg.Missile{
+			ID:     w.missileID,
+			CoordX: rnd.Float32(),
+			CoordY: rnd.Float32(),
+			Speed:  w.rules.MissileSpeed,
+			Team:   i % 2,
+			Start:  now,
+		}
+		w.missileOwner[m.ID] = w.playerTab[rnd.Intn(players)].cannonID
+		w.missileID++
+		w.missileList = append(w.missileList, m)
+	}
+
+	return w, clk
+}
+
+func TestBroadPhase(t *testing.T) {
+	broad, clk := newCrowdedWorld(50, 500, false)
+	brute, _ := newCrowdedWorld(50, 500, true)
+
+	for elap := time.Duration(0); elap < 3*time.Second; elap += tick {
+		clk.Advance(tick)
+		broad.Step(clk.Now())
+		brute.Step(clk.Now())
+
+		if broad.Missiles() != brute.Missiles() || broad.Scores() != brute.Scores() {
+			t.Fatalf("at %v: broad phase: missiles=%d scores=%v brute force: missiles=%d scores=%v",
+				elap, broad.Missiles(), broad.Scores(), brute.Missiles(), brute.Scores())
+		}
+	}
+
+	if broad.Checks() >= brute.Checks() {
+		t.Errorf("broad phase checks=%d not below brute force checks=%d", broad.Checks(), brute.Checks())
+	}
+	t.Logf("checks: broad phase=%d brute force=%d scores=%v", broad.Checks(), brute.Checks(), broad.Scores())
+}
+
+func BenchmarkStep(b *testing.B) {
+	for _, c := range []struct{ players, missiles int }{
+		{10, 100},
+		{100, 1000},
+		{500, 5000},
+	} {
+		for _, bruteForce := range []bool{false, true} {
+			name := fmt.Sprintf("players=%d/missiles=%d/brute=%v", c.players, c.missiles, bruteForce)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					w, clk := newCrowdedWorld(c.players, c.missiles, bruteForce)
+					clk.Advance(tick)
+					b.StartTimer()
+					w.Step(clk.Now())
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkNextEvent(b *testing.B) {
+	for _, c := range []struct{ players, missiles int }{
+		{10, 100},
+		{100, 1000},
+		{500, 5000},
+	} {
+		for _, bruteForce := range []bool{false, true} {
+			name := fmt.Sprintf("players=%d/missiles=%d/brute=%v", c.players, c.missiles, bruteForce)
+			b.Run(name, func(b *testing.B) {
+				w, clk := newCrowdedWorld(c.players, c.missiles, bruteForce)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					w.NextEvent(clk.Now())
+				}
+			})
+		}
+	}
+}
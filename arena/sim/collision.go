@@ -0,0 +1,333 @@
+package sim
+
+import (
+	//"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/udhos/fugo/future"
+	"github.com/udhos/fugo/msg"
+	"github.com/udhos/fugo/unit"
+)
+
+// Field borders in NDC, see unit.CannonBox and unit.MissileBox.
+const (
+	fieldLeft    = -1.0
+	fieldRight   = 1.0
+	fieldTop     = 1.0
+	cannonBottom = -1.0
+)
+
+// sweep detects collisions along missile and cannon trajectories since the last sweep, up to now.
+// Hits are exact regardless of how often sweep is called, thus it must run before
+// any change to trajectories, so the old trajectories are swept up to the change.
+// It returns true on hit or interception.
+func (w *World) sweep(now time.Time) bool {
+	from := w.swept
+	w.swept = now
+	if from.IsZero() || now.Before(from) {
+		return false
+	}
+
+	hit := false
+
+	// apply collisions in time order: a cannon destroyed by a missile stops the next one,
+	// an intercepted missile hits nothing.
+	// A hit does not change the trajectory of a cannon still alive, thus collisions found
+	// up front stay valid unless an item is gone.
+	collisions := w.collisions(from, now)
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].before(collisions[j]) })
+	for _, c := range collisions {
+		i := w.missileIndex(c.missile)
+		if i < 0 {
+			continue // missile gone
+		}
+		if c.other != nil {
+			j := w.missileIndex(c.other)
+			if j < 0 {
+				continue // other missile gone
+			}
+			w.intercept(i, j, c.when)
+		} else {
+			if c.target.cannonLife <= 0 {
+				continue // cannon destroyed
+			}
+			w.hit(i, c.target, c.when)
+		}
+		hit = true
+	}
+
+	return hit
+}
+
+// collision is a contact between a missile and either an enemy cannon or, if intercepted, another missile.
+type collision struct {
+	when    time.Time
+	missile *msg.Missile
+	other   *msg.Missile // intercepting missile, nil for cannon hit
+	target  *player
+}
+
+// before orders collisions by time. Ties go to interceptions, then lowest IDs, regardless of search order.
+func (c collision) before(c1 collision) bool {
+	switch {
+	case !c.when.Equal(c1.when):
+		return c.when.Before(c1.when)
+	case (c.other != nil) != (c1.other != nil):
+		return c.other != nil
+	case c.missile.ID != c1.missile.ID:
+		return c.missile.ID < c1.missile.ID
+	case c.other != nil:
+		return c.other.ID < c1.other.ID
+	}
+	return c.target.cannonID < c1.target.cannonID
+}
+
+// collisions finds the first contact within [from,to] of every missile-cannon pair,
+// and of every pair of opposing missiles if enabled by Rules.MissileIntercept.
+// Candidate pairs come from the broad phase.
+func (w *World) collisions(from, to time.Time) []collision {
+	var found []collision
+
+	w.missileCannonPairs(from, to, func(i int, p *player) {
+		m := w.missileList[i]
+		w.checks++
+		if t, ok := w.contact(m.CoordX, m.CoordY, m.Speed, m.Start, m.Team == 0, p, from, to); ok {
+			found = append(found, collision{when: t, missile: m, target: p})
+		}
+	})
+
+	if !w.rules.MissileIntercept {
+		return found
+	}
+
+	w.missilePairs(func(i, j int) {
+		m1, m2 := w.missileList[i], w.missileList[j]
+		if m2.ID < m1.ID {
+			m1, m2 = m2, m1 // lowest ID first, regardless of search order
+		}
+		w.checks++
+		if t, ok := w.missileContact(m1, m2, from, to); ok {
+			found = append(found, collision{when: t, missile: m1, other: m2})
+		}
+	})
+
+	return found
+}
+
+// nextCollision returns the time of the earliest collision within [from,to].
+func (w *World) nextCollision(from, to time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, c := range w.collisions(from, to) {
+		if !found || c.when.Before(next) {
+			next, found = c.when, true
+		}
+	}
+	return next, found
+}
+
+// missileContact computes the first contact within [from,to] between two missiles.
+func (w *World) missileContact(m1, m2 *msg.Missile, from, to time.Time) (time.Time, bool) {
+	start := latest(from, m1.Start, m2.Start)
+	end := to
+	for _, m := range []*msg.Missile{m1, m2} {
+		if top := m.Start.Add(future.MissileTop(m.CoordY, m.Speed)); top.Before(end) {
+			end = top // missile leaves the field
+		}
+	}
+	if start.After(end) {
+		return time.Time{}, false
+	}
+
+	a := w.missileBody(m1.CoordX, m1.CoordY, m1.Speed, m1.Start, m1.Team == 0, start)
+	b := w.missileBody(m2.CoordX, m2.CoordY, m2.Speed, m2.Start, m2.Team == 0, start)
+
+	enter, exit, ok := unit.ContactSpan(a.r, a.vx, a.vy, b.r, b.vx, b.vy, end.Sub(start).Seconds())
+	if !ok {
+		return time.Time{}, false
+	}
+	t, hit := maskContact(a, b, enter, exit)
+	if !hit {
+		return time.Time{}, false
+	}
+	return start.Add(time.Duration(t * float64(time.Second))), true
+}
+
+// contact computes the first contact within [from,to] between the missile and the cannon.
+// The cannon trajectory is split at border bounces.
+func (w *World) contact(mX, mY, mSpeed float32, mStart time.Time, mUp bool, p *player, from, to time.Time) (time.Time, bool) {
+	start := latest(from, mStart, p.cannonStart, p.spawnedAt.Add(w.invulnerable)) // missile passes through invulnerable cannon
+	end := to
+	if top := mStart.Add(future.MissileTop(mY, mSpeed)); top.Before(end) {
+		end = top // missile leaves the field
+	}
+	if start.After(end) {
+		return time.Time{}, false
+	}
+
+	m := w.missileBody(mX, mY, mSpeed, mStart, mUp, start)
+
+	cUp := p.team == 0
+	x, speed := future.CannonX(p.cannonCoordX, p.cannonSpeed, start.Sub(p.cannonStart))
+
+	for segStart := start; !segStart.After(end); {
+		// cannon moves straight until next bounce
+		segEnd := end
+		bounce := future.CannonBounce(x, speed)
+		if bounce != future.Never && segStart.Add(bounce).Before(end) {
+			segEnd = segStart.Add(bounce)
+		}
+
+		cr := unit.CannonBox(fieldLeft, fieldRight, float64(x), fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, cUp)
+		c := body{
+			mask: w.cannonMask,
+			r:    cr,
+			vx:   unit.CannonBox(fieldLeft, fieldRight, float64(x+speed), fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, cUp).X1 - cr.X1,
+			up:   cUp,
+		}
+
+		ms := m
+		ms.r = m.at(segStart.Sub(start).Seconds())
+
+		if enter, exit, ok := unit.ContactSpan(c.r, c.vx, c.vy, ms.r, ms.vx, ms.vy, segEnd.Sub(segStart).Seconds()); ok {
+			// boxes overlap, look for opaque pixels overlapping
+			if t, hit := maskContact(c, ms, enter, exit); hit {
+				return segStart.Add(time.Duration(t * float64(time.Second))), true
+			}
+		}
+
+		if segEnd.Equal(end) {
+			break
+		}
+
+		// bounce
+		if speed > 0 {
+			x = 1
+		} else {
+			x = 0
+		}
+		speed = -speed
+		segStart = segEnd
+	}
+
+	return time.Time{}, false
+}
+
+// body is a sprite box moving straight, for narrow phase collision.
+type body struct {
+	mask   *unit.Mask
+	r      unit.Rect // box at time 0
+	vx, vy float64   // box units per second
+	up     bool
+}
+
+// at returns the box at time t, in seconds.
+func (b body) at(t float64) unit.Rect {
+	return unit.Rect{X1: b.r.X1 + b.vx*t, Y1: b.r.Y1 + b.vy*t, X2: b.r.X2 + b.vx*t, Y2: b.r.Y2 + b.vy*t}
+}
+
+// missileBody returns the missile box at time start, and its velocity.
+func (w *World) missileBody(mX, mY, mSpeed float32, mStart time.Time, mUp bool, start time.Time) body {
+	y := float64(future.MissileY(mY, mSpeed, start.Sub(mStart)))
+	r := unit.MissileBox(fieldLeft, fieldRight, float64(mX), y, fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, w.missileWidth, w.missileHeight, mUp)
+	return body{
+		mask: w.missileMask,
+		r:    r,
+		vy:   unit.MissileBox(fieldLeft, fieldRight, float64(mX), y+float64(mSpeed), fieldTop, cannonBottom, w.cannonWidth, w.cannonHeight, w.missileWidth, w.missileHeight, mUp).Y1 - r.Y1,
+		up:   mUp,
+	}
+}
+
+// maskContact finds the first time within [enter,exit] when opaque pixels of both bodies overlap.
+// Time steps are small enough for boxes to move at most one pixel relative to each other.
+func maskContact(a, b body, enter, exit float64) (float64, bool) {
+	at := func(t float64) bool {
+		return unit.MaskOverlap(a.mask, a.at(t), a.up, b.mask, b.at(t), b.up)
+	}
+
+	px, py, masked := unit.PixelSize(a.mask, a.r, b.mask, b.r)
+	if !masked {
+		return enter, true // boxes only
+	}
+
+	dt := exit - enter
+	if vx := math.Abs(a.vx - b.vx); vx != 0 {
+		dt = math.Min(dt, px/vx)
+	}
+	if vy := math.Abs(a.vy - b.vy); vy != 0 {
+		dt = math.Min(dt, py/vy)
+	}
+	if dt <= 0 {
+		dt = exit - enter // degenerate box, zero pixel size
+	}
+
+	for t := enter; t < exit; t += dt {
+		if at(t) {
+			return t, true
+		}
+	}
+	return exit, at(exit)
+}
+
+// hit applies missile i hitting cannon p at time now.
+func (w *World) hit(i int, p *player, now time.Time) {
+	m := w.missileList[i]
+
+	//log.Printf("collision: %v %v", m, p)
+	owner := w.findPlayer(w.missileOwner[m.ID])
+	w.removeMissile(i)
+	if owner != nil {
+		owner.stats.Hits++
+	}
+	p.cannonLife -= w.rules.MissileDamage
+	if p.cannonLife <= 0 {
+		if owner != nil {
+			owner.stats.Kills++
+		}
+		p.stats.Deaths++
+		w.teams[m.Team].score++
+		updateCannon(p, now) // cannon freeze
+		p.cannonLife = 0     // cosmetic
+		p.cannonSpeed = 0    // cannon freeze
+		p.destroyedAt = now
+	}
+}
+
+// intercept applies missiles a and b destroying each other at time now.
+// The Intercept event is reported at missile a position.
+func (w *World) intercept(a, b int, now time.Time) {
+	m := w.missileList[a]
+
+	//log.Printf("intercept: %v %v", m, w.missileList[b])
+	w.intercepts = append(w.intercepts, &msg.Intercept{
+		CoordX: m.CoordX,
+		CoordY: future.MissileY(m.CoordY, m.Speed, now.Sub(m.Start)),
+		Team:   m.Team,
+	})
+	if a < b {
+		a, b = b, a
+	}
+	w.removeMissile(a) // remove last one first, the other stays in place
+	w.removeMissile(b)
+}
+
+// missileIndex returns the position of the missile in missileList, or -1 if gone.
+func (w *World) missileIndex(m *msg.Missile) int {
+	for i, m1 := range w.missileList {
+		if m1 == m {
+			return i
+		}
+	}
+	return -1
+}
+
+func latest(t time.Time, times ...time.Time) time.Time {
+	for _, t1 := range times {
+		if t1.After(t) {
+			t = t1
+		}
+	}
+	return t
+}
@@ -0,0 +1,68 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/udhos/fugo/future"
+)
+
+// eventHorizon bounds the search for missile contact.
+// Missiles leave the field long before.
+const eventHorizon = time.Hour
+
+// NextEvent returns the time of the next event after now that changes the world:
+// missile reaching the top, cannon bouncing on the border, missile hitting a cannon or another missile,
+// fuel reaching maximum, cannon respawn, invulnerability end or match phase timeout.
+// Step should be called at that time. Motion between events is analytic, see future.
+// It returns false if no event is expected, e.g. while paused: the world only changes on input.
+func (w *World) NextEvent(now time.Time) (time.Time, bool) {
+	if w.paused {
+		return time.Time{}, false
+	}
+
+	var next time.Time
+	found := false
+	event := func(t time.Time) {
+		if !t.After(now) {
+			return // past events are handled by Step
+		}
+		if !found || t.Before(next) {
+			next, found = t, true
+		}
+	}
+
+	for _, m := range w.missileList {
+		if top := future.MissileTop(m.CoordY, m.Speed); top != future.Never {
+			event(m.Start.Add(top))
+		}
+	}
+
+	for _, p := range w.playerTab {
+		if p.cannonLife <= 0 {
+			if w.respawn > 0 {
+				event(p.destroyedAt.Add(w.respawn))
+			}
+			continue
+		}
+		x, speed := future.CannonX(p.cannonCoordX, p.cannonSpeed, now.Sub(p.cannonStart))
+		if bounce := future.CannonBounce(x, speed); bounce != future.Never {
+			event(now.Add(bounce))
+		}
+		if w.invulnerable > 0 {
+			event(p.spawnedAt.Add(w.invulnerable))
+		}
+		if w.rules.FuelRecharge > 0 {
+			event(p.fuelStart.Add(time.Duration(float32(time.Second) * future.FuelMax / w.rules.FuelRecharge))) // fuel full
+		}
+	}
+
+	if t, found := w.nextCollision(now, now.Add(eventHorizon)); found {
+		event(t)
+	}
+
+	if left := w.matchLeft(now); left > 0 {
+		event(now.Add(left))
+	}
+
+	return next, found
+}
@@ -0,0 +1,179 @@
+package sim
+
+import (
+	"time"
+
+	"github.com/udhos/fugo/msg"
+)
+
+// MatchConfig sets the round rules.
+// A round ends when a team reaches ScoreLimit or after TimeLimit.
+// Zero limits are disabled.
+type MatchConfig struct {
+	ScoreLimit int
+	TimeLimit  time.Duration
+	Countdown  time.Duration // delay before the round starts
+	RoundOver  time.Duration // delay announcing the winner before the next round
+	TeamSize   int           // players per team required to start a round, 0 means at least one
+}
+
+type match struct {
+	config     MatchConfig
+	enabled    bool // false means single endless round, see SetMatch
+	phase      int  // msg.MatchLobby, ...
+	phaseStart time.Time
+	round      int
+	winner     int
+}
+
+// SetMatch enables the match lifecycle: lobby, countdown, playing and round over.
+// Without SetMatch the world runs a single endless round.
+// The match restarts from the lobby.
+func (w *World) SetMatch(config MatchConfig, now time.Time) {
+	now = w.worldTime(now)
+	w.match = match{config: config, enabled: true}
+	w.setPhase(msg.MatchLobby, now)
+}
+
+// UpdateMatch replaces the round rules, keeping the current phase and round.
+// New limits apply to the round in progress.
+func (w *World) UpdateMatch(config MatchConfig) {
+	w.match.config = config
+}
+
+// Match returns the match phase (msg.MatchLobby, ...), the round number
+// and the winner of the last round.
+func (w *World) Match() (phase, round, winner int) {
+	return w.match.phase, w.match.round, w.match.winner
+}
+
+func (w *World) setPhase(phase int, now time.Time) {
+	w.match.phase = phase
+	w.match.phaseStart = now
+}
+
+// stepMatch advances the match phase.
+// It returns true if the phase changed.
+func (w *World) stepMatch(now time.Time) bool {
+	m := &w.match
+	if !m.enabled {
+		return false
+	}
+
+	elap := now.Sub(m.phaseStart)
+	size := m.config.TeamSize
+	if size < 1 {
+		size = 1
+	}
+	ready := w.teams[0].count >= size && w.teams[1].count >= size // teams full
+	alive := w.teams[0].count > 0 && w.teams[1].count > 0         // no empty team
+
+	switch m.phase {
+	case msg.MatchLobby:
+		if ready {
+			w.startRound(now)
+			return true
+		}
+	case msg.MatchCountdown:
+		if !ready {
+			w.setPhase(msg.MatchLobby, now)
+			return true
+		}
+		if elap >= m.config.Countdown {
+			w.setPhase(msg.MatchPlaying, now)
+			return true
+		}
+	case msg.MatchPlaying:
+		scores := w.Scores()
+		switch {
+		case !alive:
+			w.endRound(now, w.forfeitWinner()) // a team left
+			return true
+		case m.config.ScoreLimit > 0 && (scores[0] >= m.config.ScoreLimit || scores[1] >= m.config.ScoreLimit):
+			w.endRound(now, w.leader())
+			return true
+		case m.config.TimeLimit > 0 && elap >= m.config.TimeLimit:
+			w.endRound(now, w.leader())
+			return true
+		}
+	case msg.MatchOver:
+		if elap < m.config.RoundOver {
+			return false
+		}
+		if ready {
+			w.startRound(now)
+		} else {
+			w.setPhase(msg.MatchLobby, now)
+		}
+		return true
+	}
+
+	return false
+}
+
+// matchLeft returns the time left in the match phase, 0 if unlimited.
+func (w *World) matchLeft(now time.Time) time.Duration {
+	var d time.Duration
+	switch w.match.phase {
+	case msg.MatchCountdown:
+		d = w.match.config.Countdown
+	case msg.MatchPlaying:
+		d = w.match.config.TimeLimit
+	case msg.MatchOver:
+		d = w.match.config.RoundOver
+	}
+	if d == 0 || !w.match.enabled {
+		return 0
+	}
+	left := d - now.Sub(w.match.phaseStart)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// startRound resets scores, missiles and cannons, then starts the countdown.
+func (w *World) startRound(now time.Time) {
+	w.match.round++
+	w.teams[0].score = 0
+	w.teams[1].score = 0
+	w.clearMissiles()
+	for _, p := range w.playerTab {
+		w.resetCannon(p, now)
+	}
+	w.setPhase(msg.MatchCountdown, now)
+}
+
+// endRound drops missiles in flight, thus no more hits are scored, then announces the winner.
+func (w *World) endRound(now time.Time, winner int) {
+	w.clearMissiles()
+	w.match.winner = winner
+	w.setPhase(msg.MatchOver, now)
+}
+
+// leader returns the team with higher score, or msg.WinnerDraw.
+func (w *World) leader() int {
+	switch {
+	case w.teams[0].score > w.teams[1].score:
+		return 0
+	case w.teams[1].score > w.teams[0].score:
+		return 1
+	}
+	return msg.WinnerDraw
+}
+
+// forfeitWinner returns the team remaining after the other one left.
+func (w *World) forfeitWinner() int {
+	switch {
+	case w.teams[0].count > 0 && w.teams[1].count == 0:
+		return 0
+	case w.teams[1].count > 0 && w.teams[0].count == 0:
+		return 1
+	}
+	return w.leader()
+}
+
+func (w *World) clearMissiles() {
+	w.missileList = w.missileList[:0]
+	w.missileOwner = map[int]int{}
+}
@@ -0,0 +1,50 @@
+package sim
+
+import (
+	"time"
+)
+
+// Pause stops the world clock: cannons, missiles, fuel and match timers
+// hold still until Resume. Buttons are ignored while paused.
+func (w *World) Pause(now time.Time) {
+	if w.paused {
+		return
+	}
+	w.sweep(now)
+	w.paused = true
+	w.pausedAt = now
+}
+
+// Resume restarts the world clock stopped by Pause.
+// Every time reference is shifted by the pause duration.
+func (w *World) Resume(now time.Time) {
+	if !w.paused {
+		return
+	}
+	d := now.Sub(w.pausedAt)
+	for _, p := range w.playerTab {
+		p.fuelStart = p.fuelStart.Add(d)
+		p.cannonStart = p.cannonStart.Add(d)
+		p.destroyedAt = p.destroyedAt.Add(d)
+		p.spawnedAt = p.spawnedAt.Add(d)
+	}
+	for _, m := range w.missileList {
+		m.Start = m.Start.Add(d)
+	}
+	w.match.phaseStart = w.match.phaseStart.Add(d)
+	w.swept = w.swept.Add(d)
+	w.paused = false
+}
+
+// Paused reports whether the world is paused.
+func (w *World) Paused() bool {
+	return w.paused
+}
+
+// worldTime returns the world clock: now, or the pause time while paused.
+func (w *World) worldTime(now time.Time) time.Time {
+	if w.paused {
+		return w.pausedAt
+	}
+	return now
+}
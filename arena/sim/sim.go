@@ -0,0 +1,512 @@
+// Package sim implements the arena game rules.
+// It has no network dependency, so it can be driven by the arena server,
+// by bots, by replays or by tests.
+package sim
+
+import (
+	"time"
+
+	"github.com/udhos/fugo/future"
+	"github.com/udhos/fugo/msg"
+	"github.com/udhos/fugo/unit"
+)
+
+// World holds the full game state.
+type World struct {
+	playerTab     []*player
+	missileList   []*msg.Missile
+	teams         [2]team
+	cannonWidth   float64
+	cannonHeight  float64
+	missileWidth  float64
+	missileHeight float64
+	missileID     int
+	cannonID      int
+	missileOwner  map[int]int // missile ID => cannon ID
+	match         match
+	respawn       time.Duration // delay before destroyed cannon respawns, 0 disables respawn
+	invulnerable  time.Duration // missiles pass through cannon after spawn
+	rules         msg.Rules
+	paused        bool
+	pausedAt      time.Time
+	checks        int64            // collision tests
+	intercepts    []*msg.Intercept // since last call to Intercepts
+	swept         time.Time        // collisions detected up to this time, see sweep
+	cannonMask    *unit.Mask
+	missileMask   *unit.Mask
+	bruteForce    bool // skip broad phase, test every pair. For benchmarks
+}
+
+// DefaultRules returns the rules used by New.
+func DefaultRules() msg.Rules {
+	return msg.Rules{
+		MissileSpeed:  .5,  // 50% every 1 second
+		CannonSpeed:   .15, // 15%
+		MissileDamage: .25,
+		FuelCost:      1,
+		FuelRecharge:  future.FuelRechargeRate,
+		FuelStart:     5, // 50%
+	}
+}
+
+// AnyTeam means no team preference.
+const AnyTeam = -1
+
+// Stats holds player statistics.
+type Stats struct {
+	Shots  int // missiles fired
+	Hits   int // missiles that hit an enemy cannon
+	Kills  int // enemy cannons destroyed
+	Deaths int // times the player cannon was destroyed
+}
+
+// Add sums two stats.
+func (s Stats) Add(s1 Stats) Stats {
+	return Stats{
+		Shots:  s.Shots + s1.Shots,
+		Hits:   s.Hits + s1.Hits,
+		Kills:  s.Kills + s1.Kills,
+		Deaths: s.Deaths + s1.Deaths,
+	}
+}
+
+type team struct {
+	count int // player count
+	score int // team score
+}
+
+type player struct {
+	fuelStart    time.Time
+	cannonStart  time.Time
+	cannonSpeed  float32
+	cannonCoordX float32
+	cannonLife   float32
+	cannonID     int
+	team         int
+	stats        Stats
+	frozen       bool
+	frozenSpeed  float32 // cannon speed saved by Freeze
+	destroyedAt  time.Time
+	spawnedAt    time.Time
+}
+
+// New creates an empty world.
+// Cannon and missile sizes are given in NDC, see unit.BoxSize.
+func New(cannonWidth, cannonHeight, missileWidth, missileHeight float64) *World {
+	return &World{
+		playerTab:     []*player{},
+		cannonWidth:   cannonWidth,
+		cannonHeight:  cannonHeight,
+		missileWidth:  missileWidth,
+		missileHeight: missileHeight,
+		missileOwner:  map[int]int{},
+		match:         match{phase: msg.MatchPlaying},
+		rules:         DefaultRules(),
+	}
+}
+
+// SetMasks enables pixel accurate collision with sprite masks.
+// Nil masks collide as bounding boxes.
+func (w *World) SetMasks(cannon, missile *unit.Mask) {
+	w.cannonMask = cannon
+	w.missileMask = missile
+}
+
+// SetRules replaces the game rules.
+// Cannons keep their fuel level and direction, and move at the new speed.
+// Missiles already in flight keep their speed.
+func (w *World) SetRules(r msg.Rules, now time.Time) {
+	now = w.worldTime(now)
+	w.sweep(now)
+	fuel := make([]float32, len(w.playerTab))
+	for i, p := range w.playerTab {
+		fuel[i] = w.playerFuel(p, now)
+	}
+	w.rules = r
+	for i, p := range w.playerTab {
+		w.playerFuelSet(p, now, fuel[i])
+		updateCannon(p, now)
+		p.cannonSpeed = withSpeed(p.cannonSpeed, r.CannonSpeed)
+		p.frozenSpeed = withSpeed(p.frozenSpeed, r.CannonSpeed)
+	}
+}
+
+// withSpeed keeps the direction of speed with new magnitude. A stopped cannon stays stopped.
+func withSpeed(speed, magnitude float32) float32 {
+	switch {
+	case speed > 0:
+		return magnitude
+	case speed < 0:
+		return -magnitude
+	}
+	return 0
+}
+
+// Rules returns the game rules.
+func (w *World) Rules() msg.Rules {
+	return w.rules
+}
+
+// AddPlayer spawns a new cannon.
+// The preferred team is honored unless it would unbalance the teams,
+// otherwise the player joins the smaller team. Use AnyTeam for no preference.
+// It returns the player ID, which is also the ID of the player's cannon, and the player team.
+func (w *World) AddPlayer(now time.Time, preferredTeam int) (int, int) {
+	now = w.worldTime(now)
+	w.sweep(now)
+	p := &player{}
+	if w.teams[0].count > w.teams[1].count {
+		p.team = 1
+	}
+	if preferredTeam == 0 || preferredTeam == 1 {
+		if w.teams[preferredTeam].count <= w.teams[1-preferredTeam].count {
+			p.team = preferredTeam
+		}
+	}
+	w.playerTab = append(w.playerTab, p)
+
+	w.resetCannon(p, now)
+	p.cannonID = w.cannonID
+	w.cannonID++
+	w.teams[p.team].count++
+
+	return p.cannonID, p.team
+}
+
+// SetRespawn enables respawn of destroyed cannons after delay, with full life and fuel.
+// A spawned cannon is invulnerable for the given duration.
+// A zero delay disables respawn: destroyed cannons stay destroyed until the next round.
+func (w *World) SetRespawn(delay, invulnerable time.Duration) {
+	w.respawn = delay
+	w.invulnerable = invulnerable
+}
+
+// RemovePlayer deletes the player cannon from the world.
+// It returns false if the player is not found.
+func (w *World) RemovePlayer(id int) bool {
+	for i, p := range w.playerTab {
+		if p.cannonID == id {
+			//w.playerTab = append(w.playerTab[:i], w.playerTab[i+1:]...)
+			if i < len(w.playerTab)-1 {
+				w.playerTab[i] = w.playerTab[len(w.playerTab)-1]
+			}
+			w.playerTab = w.playerTab[:len(w.playerTab)-1]
+			w.teams[p.team].count--
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyButton applies a button pressed by the player.
+// update reports whether the world changed and should be sent to players.
+// fire reports whether a missile was fired.
+func (w *World) ApplyButton(id int, b msg.Button, now time.Time) (update, fire bool) {
+	now = w.worldTime(now)
+	if w.paused {
+		return // world paused
+	}
+
+	update = w.sweep(now) // hits before the button changes trajectories
+
+	p := w.findPlayer(id)
+	if p == nil {
+		return // player not found
+	}
+
+	if p.cannonLife <= 0 {
+		return // cannon destroyed
+	}
+
+	if p.frozen {
+		return // player detached
+	}
+
+	if b.ID == msg.ButtonTurn {
+		updateCannon(p, now)
+		p.cannonSpeed = -p.cannonSpeed
+		update = true
+		return
+	}
+
+	if b.ID != msg.ButtonFire {
+		return // non-fire button
+	}
+
+	if w.match.phase != msg.MatchPlaying {
+		return // round not running
+	}
+
+	if w.playerFuel(p, now) < w.rules.FuelCost {
+		return // not enough fuel
+	}
+
+	w.playerFuelConsume(p, now, w.rules.FuelCost)
+
+	updateCannon(p, now)
+	miss1 := &msg.Missile{
+		ID:     w.missileID,
+		CoordX: p.cannonCoordX,
+		Speed:  w.rules.MissileSpeed,
+		Team:   p.team,
+		Start:  now,
+	}
+	w.missileOwner[miss1.ID] = p.cannonID
+	w.missileID++
+	w.missileList = append(w.missileList, miss1)
+	p.stats.Shots++
+
+	update = true
+	fire = true
+	return
+}
+
+// Step advances the world up to now.
+// It respawns destroyed cannons, drops missiles that left the field, detects collisions
+// and advances the match phase.
+// Positions are analytic, so a cannon is only rebased when it bounces,
+// and missiles are never rebased: unchanged items stay unchanged in snapshots.
+// It returns true if any cannon respawned, any missile hit a cannon or another missile, or the match phase changed.
+func (w *World) Step(now time.Time) bool {
+	now = w.worldTime(now)
+	if w.paused {
+		return false
+	}
+
+	hit := w.sweep(now)
+
+	var respawn bool
+
+	for _, p := range w.playerTab {
+		if p.cannonLife <= 0 && w.respawn > 0 && now.Sub(p.destroyedAt) >= w.respawn {
+			w.resetCannon(p, now)
+			respawn = true
+			continue
+		}
+		if _, speed := future.CannonX(p.cannonCoordX, p.cannonSpeed, now.Sub(p.cannonStart)); speed != p.cannonSpeed {
+			updateCannon(p, now) // bounce
+		}
+	}
+
+	for i := 0; i < len(w.missileList); i++ {
+		m := w.missileList[i]
+		if future.MissileY(m.CoordY, m.Speed, now.Sub(m.Start)) >= 1 {
+			w.removeMissile(i)
+			i--
+		}
+	}
+
+	return w.stepMatch(now) || hit || respawn
+}
+
+// Snapshot builds the world update as seen by the player.
+// It returns false if the player is not found.
+func (w *World) Snapshot(id int, now time.Time) (msg.Update, bool) {
+	p := w.findPlayer(id)
+	if p == nil {
+		return msg.Update{}, false
+	}
+	return w.snapshot(p, now), true
+}
+
+// Spectate builds the world update as seen by a spectator, who owns no cannon.
+func (w *World) Spectate(now time.Time) msg.Update {
+	return w.snapshot(nil, now)
+}
+
+// snapshot builds the update for player p, or for a spectator if p is nil.
+func (w *World) snapshot(p *player, now time.Time) msg.Update {
+	now = w.worldTime(now)
+	update := msg.Update{
+		WorldMissiles: w.missileList,
+		Team:          msg.TeamSpectator,
+		Scores:        w.Scores(),
+		Match:         w.match.phase,
+		MatchLeft:     w.matchLeft(now),
+		Round:         w.match.round,
+		Winner:        w.match.winner,
+		Now:           now,
+		Paused:        w.paused,
+	}
+
+	if p != nil {
+		update.Fuel = w.playerFuel(p, now)
+		update.Team = p.team
+	}
+
+	for _, p1 := range w.playerTab {
+		cannon := msg.Cannon{
+			ID:     p1.cannonID,
+			Start:  p1.cannonStart,
+			CoordX: p1.cannonCoordX,
+			Speed:  p1.cannonSpeed,
+			Team:   p1.team,
+			Life:   p1.cannonLife,
+			Player: p1 == p,
+
+			Respawn:      w.respawnAt(p1),
+			Invulnerable: invulnerable(w, p1, now),
+		}
+		update.Cannons = append(update.Cannons, &cannon)
+	}
+
+	return update
+}
+
+// Freeze stops the player cannon, keeping it in the world.
+// A frozen cannon ignores buttons until Unfreeze.
+// It returns false if the player is not found.
+func (w *World) Freeze(id int, now time.Time) bool {
+	now = w.worldTime(now)
+	w.sweep(now)
+	p := w.findPlayer(id)
+	if p == nil {
+		return false
+	}
+	if p.frozen {
+		return true
+	}
+	updateCannon(p, now)
+	p.frozenSpeed = p.cannonSpeed
+	p.cannonSpeed = 0
+	p.frozen = true
+	return true
+}
+
+// Unfreeze restores the cannon stopped by Freeze.
+// It returns false if the player is not found.
+func (w *World) Unfreeze(id int, now time.Time) bool {
+	now = w.worldTime(now)
+	w.sweep(now)
+	p := w.findPlayer(id)
+	if p == nil {
+		return false
+	}
+	if !p.frozen {
+		return true
+	}
+	updateCannon(p, now)
+	if p.cannonLife > 0 {
+		p.cannonSpeed = p.frozenSpeed
+	}
+	p.frozen = false
+	return true
+}
+
+// Stats returns the player statistics.
+// It returns false if the player is not found.
+func (w *World) Stats(id int) (Stats, bool) {
+	p := w.findPlayer(id)
+	if p == nil {
+		return Stats{}, false
+	}
+	return p.stats, true
+}
+
+// ResetScores zeroes team scores.
+func (w *World) ResetScores() {
+	w.teams[0].score = 0
+	w.teams[1].score = 0
+}
+
+// Status returns the player cannon life and fuel.
+// It returns false if the player is not found.
+func (w *World) Status(id int, now time.Time) (life, fuel float32, found bool) {
+	now = w.worldTime(now)
+	p := w.findPlayer(id)
+	if p == nil {
+		return
+	}
+	return p.cannonLife, w.playerFuel(p, now), true
+}
+
+// Scores returns team scores.
+func (w *World) Scores() [2]int {
+	return [2]int{w.teams[0].score, w.teams[1].score}
+}
+
+// TeamCount returns the number of players in team.
+func (w *World) TeamCount(team int) int {
+	return w.teams[team].count
+}
+
+// Missiles returns the number of missiles in flight.
+func (w *World) Missiles() int {
+	return len(w.missileList)
+}
+
+// Checks returns the number of narrow phase collision tests so far.
+func (w *World) Checks() int64 {
+	return w.checks
+}
+
+// Intercepts returns the missiles destroyed by each other since the previous call,
+// see msg.Rules.MissileIntercept.
+func (w *World) Intercepts() []*msg.Intercept {
+	i := w.intercepts
+	w.intercepts = nil
+	return i
+}
+
+func (w *World) findPlayer(id int) *player {
+	for _, p := range w.playerTab {
+		if p.cannonID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (w *World) removeMissile(i int) {
+	delete(w.missileOwner, w.missileList[i].ID)
+	last := len(w.missileList) - 1
+	if i < last {
+		w.missileList[i] = w.missileList[last]
+	}
+	w.missileList = w.missileList[:last]
+}
+
+// respawnAt returns when the destroyed cannon respawns,
+// zero if the cannon is alive or respawn is disabled.
+func (w *World) respawnAt(p *player) time.Time {
+	if p.cannonLife > 0 || w.respawn == 0 {
+		return time.Time{}
+	}
+	return p.destroyedAt.Add(w.respawn)
+}
+
+func invulnerable(w *World, p *player, now time.Time) bool {
+	return now.Sub(p.spawnedAt) < w.invulnerable
+}
+
+// resetCannon respawns the cannon at the field center, with full life and start fuel.
+func (w *World) resetCannon(p *player, now time.Time) {
+	w.playerFuelSet(p, now, w.rules.FuelStart)
+	p.cannonStart = now
+	p.cannonSpeed = w.rules.CannonSpeed
+	p.cannonCoordX = .5 // 50%
+	p.cannonLife = 1    // 100%
+	p.spawnedAt = now
+	if p.frozen {
+		p.frozenSpeed = p.cannonSpeed
+		p.cannonSpeed = 0
+	}
+}
+
+func updateCannon(p *player, now time.Time) {
+	p.cannonCoordX, p.cannonSpeed = future.CannonX(p.cannonCoordX, p.cannonSpeed, now.Sub(p.cannonStart))
+	p.cannonStart = now
+}
+
+func (w *World) playerFuel(p *player, now time.Time) float32 {
+	return future.FuelRecharge(0, w.rules.FuelRecharge, now.Sub(p.fuelStart))
+}
+
+func (w *World) playerFuelSet(p *player, now time.Time, fuel float32) {
+	p.fuelStart = now.Add(-time.Duration(float32(time.Second) * fuel / w.rules.FuelRecharge))
+}
+
+func (w *World) playerFuelConsume(p *player, now time.Time, amount float32) {
+	fuel := w.playerFuel(p, now)
+	w.playerFuelSet(p, now, fuel-amount)
+}
@@ -0,0 +1,371 @@
+package sim
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+	"time"
+
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+	"github.com/udhos/fugo/unit"
+)
+
+const tick = 100 * time.Millisecond
+
+func newTestWorld() (*World, *clock.Fake) {
+	// wide cannons keep the cannons aligned while the missile travels
+	return New(1, .2, .05, .1), clock.NewFake(time.Unix(0, 0))
+}
+
+// run drives the world with the fake clock, one tick at a time.
+func run(w *World, clk *clock.Fake, d time.Duration) (hits int) {
+	ticker := clk.NewTicker(tick)
+	defer ticker.Stop()
+	for elap := time.Duration(0); elap < d; elap += tick {
+		clk.Advance(tick)
+		now := <-ticker.C()
+		if w.Step(now) {
+			hits++
+		}
+	}
+	return
+}
+
+func fuel(t *testing.T, w *World, id int, now time.Time) float32 {
+	u, found := w.Snapshot(id, now)
+	if !found {
+		t.Fatalf("player not found: %d", id)
+	}
+	return u.Fuel
+}
+
+func near(a, b float32) bool {
+	d := a - b
+	return d > -.001 && d < .001
+}
+
+func TestFuel(t *testing.T) {
+	w, clk := newTestWorld()
+	id, _ := w.AddPlayer(clk.Now(), AnyTeam)
+
+	if f := fuel(t, w, id, clk.Now()); !near(f, 5) {
+		t.Errorf("initial fuel: expected=5 result=%v", f)
+	}
+
+	update, fire := w.ApplyButton(id, msg.Button{ID: msg.ButtonFire}, clk.Now())
+	if !update || !fire {
+		t.Errorf("fire: update=%v fire=%v", update, fire)
+	}
+	if f := fuel(t, w, id, clk.Now()); !near(f, 4) {
+		t.Errorf("fuel after fire: expected=4 result=%v", f)
+	}
+
+	run(w, clk, 3*time.Second)
+
+	if f := fuel(t, w, id, clk.Now()); !near(f, 5) {
+		t.Errorf("fuel after recharge: expected=5 result=%v", f)
+	}
+}
+
+func TestHit(t *testing.T) {
+	w, clk := newTestWorld()
+	id0, team0 := w.AddPlayer(clk.Now(), AnyTeam)
+	id1, team1 := w.AddPlayer(clk.Now(), AnyTeam)
+	if team0 == team1 {
+		t.Fatalf("players on same team: %d", team0)
+	}
+
+	var hits int
+	for i := 0; i < 4; i++ {
+		if _, fire := w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now()); !fire {
+			t.Fatalf("missile %d not fired", i)
+		}
+		hits += run(w, clk, 2*time.Second)
+	}
+
+	if hits != 4 {
+		t.Errorf("hits: expected=4 result=%d", hits)
+	}
+	if w.Missiles() != 0 {
+		t.Errorf("missiles: expected=0 result=%d", w.Missiles())
+	}
+	if s := w.Scores(); s[team0] != 1 || s[team1] != 0 {
+		t.Errorf("scores: %v", s)
+	}
+	if s, _ := w.Stats(id0); s != (Stats{Shots: 4, Hits: 4, Kills: 1}) {
+		t.Errorf("shooter stats: %+v", s)
+	}
+	if s, _ := w.Stats(id1); s != (Stats{Deaths: 1}) {
+		t.Errorf("target stats: %+v", s)
+	}
+
+	u, _ := w.Snapshot(id1, clk.Now())
+	for _, c := range u.Cannons {
+		if c.ID == id1 && c.Life != 0 {
+			t.Errorf("cannon life: expected=0 result=%v", c.Life)
+		}
+	}
+
+	if update, _ := w.ApplyButton(id1, msg.Button{ID: msg.ButtonFire}, clk.Now()); update {
+		t.Errorf("destroyed cannon fired")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	w, clk := newTestWorld()
+	w.SetMatch(MatchConfig{ScoreLimit: 1, Countdown: time.Second, RoundOver: time.Second}, clk.Now())
+
+	id0, team0 := w.AddPlayer(clk.Now(), 0)
+	run(w, clk, tick)
+	if phase, _, _ := w.Match(); phase != msg.MatchLobby {
+		t.Fatalf("single player: expected lobby, result phase=%d", phase)
+	}
+
+	id1, _ := w.AddPlayer(clk.Now(), 1)
+	run(w, clk, tick)
+	if phase, round, _ := w.Match(); phase != msg.MatchCountdown || round != 1 {
+		t.Fatalf("two players: expected countdown round 1, result phase=%d round=%d", phase, round)
+	}
+	if _, fire := w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now()); fire {
+		t.Errorf("fired during countdown")
+	}
+
+	run(w, clk, time.Second)
+	if phase, _, _ := w.Match(); phase != msg.MatchPlaying {
+		t.Fatalf("after countdown: expected playing, result phase=%d", phase)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, fire := w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now()); !fire {
+			t.Fatalf("missile %d not fired", i)
+		}
+		run(w, clk, 2*time.Second)
+	}
+
+	u, _ := w.Snapshot(id1, clk.Now())
+	if u.Match != msg.MatchOver || u.Winner != team0 {
+		t.Fatalf("score limit: expected round over won by team %d, result phase=%d winner=%d", team0, u.Match, u.Winner)
+	}
+
+	run(w, clk, time.Second)
+	u, _ = w.Snapshot(id1, clk.Now())
+	if u.Match != msg.MatchCountdown || u.Round != 2 {
+		t.Fatalf("next round: expected countdown round 2, result phase=%d round=%d", u.Match, u.Round)
+	}
+	if u.Scores != [2]int{} {
+		t.Errorf("next round: scores not reset: %v", u.Scores)
+	}
+	for _, c := range u.Cannons {
+		if c.Life != 1 {
+			t.Errorf("next round: cannon %d life: expected=1 result=%v", c.ID, c.Life)
+		}
+	}
+
+	w.RemovePlayer(id1)
+	run(w, clk, tick)
+	if phase, _, _ := w.Match(); phase != msg.MatchLobby {
+		t.Errorf("player left: expected lobby, result phase=%d", phase)
+	}
+}
+
+func TestRespawn(t *testing.T) {
+	w, clk := newTestWorld()
+	w.SetRespawn(3*time.Second, 5*time.Second)
+	id0, _ := w.AddPlayer(clk.Now(), AnyTeam)
+	id1, _ := w.AddPlayer(clk.Now(), AnyTeam)
+
+	run(w, clk, 5*time.Second) // wait for spawn invulnerability to expire
+
+	for i := 0; i < 4; i++ {
+		w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now())
+		run(w, clk, 2*time.Second)
+	}
+
+	cannon := func() *msg.Cannon {
+		u, _ := w.Snapshot(id1, clk.Now())
+		for _, c := range u.Cannons {
+			if c.ID == id1 {
+				return c
+			}
+		}
+		t.Fatalf("cannon not found: %d", id1)
+		return nil
+	}
+
+	if c := cannon(); c.Life != 0 || !c.Respawn.After(clk.Now()) || c.Respawn.After(clk.Now().Add(3*time.Second)) {
+		t.Fatalf("destroyed cannon: life=%v respawn=%v now=%v", c.Life, c.Respawn, clk.Now())
+	}
+
+	run(w, clk, 3*time.Second)
+
+	c := cannon()
+	if c.Life != 1 || !c.Respawn.IsZero() || !c.Invulnerable {
+		t.Fatalf("respawned cannon: life=%v respawn=%v invulnerable=%v", c.Life, c.Respawn, c.Invulnerable)
+	}
+	if f := fuel(t, w, id1, clk.Now()); f < 5 {
+		t.Errorf("respawned fuel: expected>=5 result=%v", f)
+	}
+
+	// missile passes through invulnerable cannon
+	w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now())
+	run(w, clk, 2*time.Second)
+	if c := cannon(); c.Life != 1 {
+		t.Errorf("invulnerable cannon hit: life=%v", c.Life)
+	}
+}
+
+func TestSweptHit(t *testing.T) {
+	w, clk := newTestWorld()
+	id0, _ := w.AddPlayer(clk.Now(), AnyTeam)
+	w.AddPlayer(clk.Now(), AnyTeam)
+
+	if _, fire := w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now()); !fire {
+		t.Fatalf("missile not fired")
+	}
+
+	// a single step long after the missile crossed the cannon still detects the hit
+	clk.Advance(10 * time.Second)
+	if !w.Step(clk.Now()) {
+		t.Errorf("missile tunneled through cannon")
+	}
+	if w.Missiles() != 0 {
+		t.Errorf("missiles: expected=0 result=%d", w.Missiles())
+	}
+}
+
+func TestNextEvent(t *testing.T) {
+	w, clk := newTestWorld()
+	id0, _ := w.AddPlayer(clk.Now(), AnyTeam)
+	w.AddPlayer(clk.Now(), AnyTeam)
+
+	w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now())
+
+	// stepping only at scheduled events finds the hit
+	for i := 0; i < 10; i++ {
+		next, found := w.NextEvent(clk.Now())
+		if !found {
+			t.Fatalf("no event scheduled")
+		}
+		clk.Advance(next.Sub(clk.Now()))
+		if w.Step(clk.Now()) {
+			if w.Missiles() != 0 {
+				t.Errorf("missiles after hit: expected=0 result=%d", w.Missiles())
+			}
+			return
+		}
+	}
+	t.Errorf("missile did not hit within 10 events")
+}
+
+func TestMaskHit(t *testing.T) {
+	solid := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(solid, solid.Bounds(), image.Opaque, image.Point{}, draw.Src)
+	clear := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+
+	for _, c := range []struct {
+		name   string
+		cannon *image.NRGBA
+		hit    bool
+	}{
+		{"opaque cannon", solid, true},
+		{"transparent cannon", clear, false},
+	} {
+		w, clk := newTestWorld()
+		w.SetMasks(unit.NewMask(c.cannon, 4), unit.NewMask(solid, 4))
+		id0, _ := w.AddPlayer(clk.Now(), AnyTeam)
+		w.AddPlayer(clk.Now(), AnyTeam)
+		w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now())
+		if hits := run(w, clk, 3*time.Second); (hits > 0) != c.hit {
+			t.Errorf("%s: expected hit=%v hits=%d", c.name, c.hit, hits)
+		}
+	}
+}
+
+func TestMaskContactDegenerate(t *testing.T) {
+	solid := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(solid, solid.Bounds(), image.Opaque, image.Point{}, draw.Src)
+	mask := unit.NewMask(solid, 4)
+
+	flat := body{mask: mask, r: unit.Rect{X1: 0, Y1: 0, X2: 0, Y2: .1}, vx: 1} // zero width
+	box := body{mask: mask, r: unit.Rect{X1: .4, Y1: 0, X2: .6, Y2: .1}}
+
+	done := make(chan struct{})
+	go func() {
+		maskContact(flat, box, 0, 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("maskContact hangs on zero pixel size")
+	}
+}
+
+func TestIntercept(t *testing.T) {
+	for _, intercept := range []bool{false, true} {
+		w, clk := newTestWorld()
+		rules := w.Rules()
+		rules.MissileIntercept = intercept
+		w.SetRules(rules, clk.Now())
+		id0, _ := w.AddPlayer(clk.Now(), AnyTeam)
+		id1, _ := w.AddPlayer(clk.Now(), AnyTeam)
+		w.ApplyButton(id0, msg.Button{ID: msg.ButtonFire}, clk.Now())
+		w.ApplyButton(id1, msg.Button{ID: msg.ButtonFire}, clk.Now())
+
+		if next, _ := w.NextEvent(clk.Now()); intercept && next.Sub(clk.Now()) >= time.Second {
+			t.Errorf("intercept=%v: next event in %v, expected interception before 1s", intercept, next.Sub(clk.Now()))
+		}
+
+		run(w, clk, 1500*time.Millisecond) // missiles cross half way, before reaching cannons
+
+		missiles, intercepts := 2, 0
+		if intercept {
+			missiles, intercepts = 0, 1
+		}
+		if m := w.Missiles(); m != missiles {
+			t.Errorf("intercept=%v: missiles: expected=%d result=%d", intercept, missiles, m)
+		}
+		if i := w.Intercepts(); len(i) != intercepts {
+			t.Errorf("intercept=%v: intercepts: expected=%d result=%d", intercept, intercepts, len(i))
+		}
+		if i := w.Intercepts(); len(i) != 0 {
+			t.Errorf("intercept=%v: intercepts not cleared: %d", intercept, len(i))
+		}
+
+		run(w, clk, 2*time.Second)
+		if life, _, _ := w.Status(id0, clk.Now()); intercept != (life == 1) {
+			t.Errorf("intercept=%v: unexpected cannon life=%v", intercept, life)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	w, clk := newTestWorld()
+	id, _ := w.AddPlayer(clk.Now(), AnyTeam)
+
+	w.ApplyButton(id, msg.Button{ID: msg.ButtonFire}, clk.Now())
+	w.Pause(clk.Now())
+
+	clk.Advance(10 * time.Second)
+
+	if _, fire := w.ApplyButton(id, msg.Button{ID: msg.ButtonFire}, clk.Now()); fire {
+		t.Errorf("fire while paused")
+	}
+	if f := fuel(t, w, id, clk.Now()); !near(f, 4) {
+		t.Errorf("fuel while paused: expected=4 result=%v", f)
+	}
+	if n := w.Missiles(); n != 1 {
+		t.Errorf("missiles while paused: expected=1 result=%d", n)
+	}
+
+	w.Resume(clk.Now())
+
+	if f := fuel(t, w, id, clk.Now()); !near(f, 4) {
+		t.Errorf("fuel after resume: expected=4 result=%v", f)
+	}
+	run(w, clk, 10*time.Second)
+	if n := w.Missiles(); n != 0 {
+		t.Errorf("missiles after resume: expected=0 result=%d", n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+const websocketPath = "/arena"
+
+// listenAndServeWebSocket accepts clients over WebSocket, for browser builds and spectators.
+// Messages are the same as in the TCP transport, carried in binary frames.
+func listenAndServeWebSocket(ctx context.Context, s *server, addr string) error {
+
+	log.Printf("serving websocket on %s %s", addr, websocketPath)
+
+	listener, errListen := net.Listen("tcp", addr)
+	if errListen != nil {
+		return fmt.Errorf("listenAndServeWebSocket: %s: %v", addr, errListen)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close() // stop accepting
+	}()
+
+	go func() {
+		errServe := http.Serve(listener, websocketHandler(s))
+		log.Printf("listenAndServeWebSocket: %s: %v", addr, errServe)
+	}()
+
+	return nil
+}
+
+// websocketHandler hands connections on websocketPath to connHandler.
+func websocketHandler(s *server) http.Handler {
+	server := websocket.Server{
+		// accept any origin: pages may be served from anywhere
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			connHandler(s, wsConn{Conn: ws, addr: wsRemoteAddr(ws.Request())})
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(websocketPath, server)
+
+	return mux
+}
+
+// wsConn reports the client address, since websocket.Conn reports the origin.
+type wsConn struct {
+	*websocket.Conn
+	addr net.Addr
+}
+
+func (c wsConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func wsRemoteAddr(r *http.Request) net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
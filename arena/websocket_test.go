@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/udhos/fugo/clock"
+	"github.com/udhos/fugo/msg"
+)
+
+func TestWebSocket(t *testing.T) {
+	s := &server{clock: clock.Real, config: defaultConfig(), profiles: newProfileStore(10), rooms: map[string]*world{},
+		maxRooms: 1, writeTimeout: 10 * time.Second, inputRate: 20, inputBurst: 40, inputMax: 4096,
+		inputAbuse: 100, inputAbuseWindow: 10 * time.Second}
+	defer func() {
+		s.mutex.Lock()
+		for _, w := range s.rooms {
+			close(w.quit)
+		}
+		s.mutex.Unlock()
+	}()
+
+	srv := httptest.NewServer(websocketHandler(s))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + websocketPath
+	ws, errDial := websocket.Dial(url, "", srv.URL)
+	if errDial != nil {
+		t.Fatalf("dial: %v", errDial)
+	}
+	defer ws.Close()
+	ws.PayloadType = websocket.BinaryFrame
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := msg.WritePreamble(ws, msg.CodecBinary); err != nil {
+		t.Fatalf("preamble: %v", err)
+	}
+	codec := msg.FindCodec(msg.CodecBinary)
+	enc := codec.NewEncoder(ws)
+	dec := codec.NewDecoder(ws)
+
+	hello := msg.Hello{Protocol: msg.Protocol, PlayerID: "player1", Name: "player1", Codecs: []string{msg.CodecBinary}}
+	if err := enc.Encode(hello); err != nil {
+		t.Fatalf("hello: %v", err)
+	}
+	m, errWelcome := dec.Decode()
+	if errWelcome != nil {
+		t.Fatalf("welcome: %v", errWelcome)
+	}
+	if welcome, ok := m.(msg.Welcome); !ok || !welcome.Accepted || welcome.Codec != msg.CodecBinary || welcome.Room != msg.DefaultRoom {
+		t.Fatalf("welcome: %+v", m)
+	}
+	if m, err := dec.Decode(); err != nil {
+		t.Fatalf("first update: %v", err)
+	} else if _, ok := m.(msg.Update); !ok {
+		t.Fatalf("first update: %T", m)
+	}
+
+	// frame header larger than -inputmax, payload never sent
+	if _, err := ws.Write([]byte{0, 0x10, 0, 0}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for {
+		if _, err := dec.Decode(); err != nil {
+			if strings.Contains(err.Error(), "timeout") {
+				t.Fatalf("oversized frame: connection kept: %v", err)
+			}
+			break // disconnected
+		}
+	}
+	if abusive := atomic.LoadInt64(&s.metrics.abusive); abusive != 1 {
+		t.Errorf("abusive: expected=1 result=%d", abusive)
+	}
+}
@@ -56,6 +56,8 @@ mobilebuild() {
     echo gomobile install $sub
 }
 
+check ./arena/sim
+check ./clock
 check ./future
 check ./msg
 check ./trace
@@ -79,6 +79,8 @@ get github.com/faiface/beep
 get github.com/hajimehoshi/oto
 get github.com/pkg/errors
 
+check arena/sim
+check clock
 check future
 check msg
 check trace
@@ -0,0 +1,85 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeTickerDrop(t *testing.T) {
+	start := time.Unix(0, 0)
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	f.Advance(3 * time.Second) // three ticks due, only the first fits the channel
+
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(time.Second)) {
+			t.Errorf("tick: expected=%v result=%v", start.Add(time.Second), tick)
+		}
+	default:
+		t.Fatalf("tick missing")
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("tick not dropped: %v", tick)
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(4 * time.Second)) {
+			t.Errorf("tick after drop: expected=%v result=%v", start.Add(4*time.Second), tick)
+		}
+	default:
+		t.Errorf("tick missing after drop")
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	start := time.Unix(0, 0)
+	f := NewFake(start)
+	timer := f.NewTimer(2 * time.Second)
+
+	f.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Fatalf("timer fired before deadline")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case tick := <-timer.C():
+		if !tick.Equal(start.Add(2 * time.Second)) {
+			t.Errorf("timer: expected=%v result=%v", start.Add(2*time.Second), tick)
+		}
+	default:
+		t.Fatalf("timer did not fire at deadline")
+	}
+
+	f.Advance(10 * time.Second)
+	select {
+	case tick := <-timer.C():
+		t.Errorf("timer fired twice: %v", tick)
+	default:
+	}
+}
+
+func TestFakeTimerStop(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	timer := f.NewTimer(time.Second)
+	timer.Stop()
+	if len(f.timers) != 0 {
+		t.Errorf("pending timers after stop: %d", len(f.timers))
+	}
+
+	f.Advance(2 * time.Second)
+	select {
+	case tick := <-timer.C():
+		t.Errorf("stopped timer fired: %v", tick)
+	default:
+	}
+}
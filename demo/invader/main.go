@@ -4,8 +4,9 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
-	"encoding/gob"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"image/color"
@@ -13,8 +14,10 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/udhos/goglmath"
@@ -79,6 +82,7 @@ type gameState struct {
 
 	atlas      *fontAtlas
 	t1         *fontText
+	status     string // text in t1, see writeStatus
 	scoreOur   *fontText
 	scoreTheir *fontText
 
@@ -88,16 +92,32 @@ type gameState struct {
 	shaderTexVert          string
 	shaderTexFrag          string
 	serverAddr             string
+	playerName             string
 	serverOutput           chan msg.Button
 	playerFuel             float32
 	playerTeam             int
+	round                  int
+	rules                  msg.Rules // advertised by server
+	paused                 bool
+	notice                 string // text broadcast by server admin
+	noticeUntil            time.Time
 	updateInterval         time.Duration
 	updateLast             time.Time
+	lastUpdate             msg.Update // status countdowns run from it, see matchStatus
 	missiles               map[int]*msg.Missile
 	cannons                map[int]*msg.Cannon
+	explosions             []explosion // intercepted missiles
 	tracer                 *trace.Trace
 }
 
+// explosion is painted where opposing missiles destroyed each other.
+type explosion struct {
+	intercept *msg.Intercept
+	until     time.Time
+}
+
+const explosionDuration = 500 * time.Millisecond
+
 func playLaser(game *gameState) {
 	game.streamLaser.Seek(0)
 	speaker.Play(beep.Seq(game.streamLaser))
@@ -163,6 +183,10 @@ func newGame() (*gameState, error) {
 
 	log.Printf("server: [%s]", game.serverAddr)
 
+	if errName := flagStr(&game.playerName, "name.txt"); errName != nil {
+		log.Printf("player name: %v", errName)
+	}
+
 	var tracer string
 	errTrace := flagStr(&tracer, "trace.txt")
 	if errTrace != nil {
@@ -203,42 +227,63 @@ func flipY(name string, img *image.NRGBA) {
 	log.Printf("image y-flipped: %s", name)
 }
 
-func loadID() {
+const idFile = "invader_id.txt"
+
+// idDirs lists candidate directories for the player ID file.
+// Current dir is preferred, but it is not writable on Android,
+// where TMPDIR points to the app private cache.
+func idDirs() []string {
+	return []string{".", os.TempDir()}
+}
+
+// loadID returns the persistent player ID, creating it on first run.
+func loadID() string {
 	wd, errWd := os.Getwd()
 	log.Printf("loadID: dir=%s error=%v", wd, errWd)
-	idFile := "invader_id.txt"
-	f, errOpen := os.Open(idFile)
-	if errOpen != nil {
-		log.Printf("loadID: %s: %v", idFile, errOpen)
-		return
+	for _, dir := range idDirs() {
+		path := filepath.Join(dir, idFile)
+		buf, errRead := ioutil.ReadFile(path)
+		if errRead != nil {
+			log.Printf("loadID: %s: %v", path, errRead)
+			continue
+		}
+		id := strings.TrimSpace(string(buf))
+		if id == "" {
+			log.Printf("loadID: %s: empty id", path)
+			continue
+		}
+		log.Printf("loadID: %s: id=%s", path, id)
+		return id
 	}
-	defer f.Close()
-	buf, errRead := ioutil.ReadAll(f)
-	if errRead != nil {
-		log.Printf("loadID: %s: %v", idFile, errRead)
-		return
+
+	id, errID := newID()
+	if errID != nil {
+		log.Printf("loadID: new id: %v", errID)
+		return ""
 	}
-	id := string(buf)
-	log.Printf("loadID: id=%s", id)
+	saveID(id)
+	return id
 }
 
-func saveID() {
-	wd, errWd := os.Getwd()
-	log.Printf("saveID: dir=%s error=%v", wd, errWd)
-	idFile := "invader_id.txt"
-	f, errOpen := os.Create(idFile)
-	if errOpen != nil {
-		log.Printf("saveID: %s: %v", idFile, errOpen)
-		return
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
-	defer f.Close()
-	id := "3"
-	_, errWrite := f.WriteString(id)
-	if errWrite != nil {
-		log.Printf("saveID: %s: %v", idFile, errWrite)
+	return hex.EncodeToString(buf), nil
+}
+
+func saveID(id string) {
+	for _, dir := range idDirs() {
+		path := filepath.Join(dir, idFile)
+		errWrite := ioutil.WriteFile(path, []byte(id), 0600)
+		if errWrite != nil {
+			log.Printf("saveID: %s: %v", path, errWrite)
+			continue
+		}
+		log.Printf("saveID: %s: id=%s", path, id)
 		return
 	}
-	log.Printf("saveID: id=%s", id)
 }
 
 func main() {
@@ -260,16 +305,28 @@ func main() {
 		return
 	}
 
-	gob.Register(msg.Update{})
-	gob.Register(msg.Button{})
+	id := loadID()
+
+	hello := msg.Hello{
+		Version:  version.Version,
+		Protocol: msg.Protocol,
+		PlayerID: id,
+		Name:     game.playerName,
+		Codecs:   msg.CodecNames(),
+	}
 
-	loadID()
-	saveID()
+	flagBool(&hello.Spectator, "spectate.txt")
+	flagStr(&hello.Room, "room.txt")
+
+	var codec string
+	if errCodec := flagStr(&codec, "codec.txt"); errCodec == nil {
+		hello.Codecs = []string{codec} // force codec
+	}
 
 	app.Main(func(a app.App) {
 		log.Print("app.Main begin")
 
-		go serverHandler(a, game.serverAddr, game.serverOutput)
+		go serverHandler(a, game.serverAddr, hello, game.serverOutput)
 
 	LOOP:
 		for e := range a.Events() {
@@ -320,6 +377,7 @@ func main() {
 
 				//if !slowPaint || paintRequests == 0 {
 				paints++
+				game.writeStatus() // countdowns, server sends no periodic updates
 				game.paint()
 				a.Publish()
 				//}
@@ -341,15 +399,56 @@ func main() {
 				game.input(press, release, t.X, t.Y)
 			case size.Event:
 				game.resize(t.WidthPx, t.HeightPx)
+			case msg.Welcome:
+				game.rules = t.Rules
+				if !t.Accepted {
+					log.Printf("app.Main: refused by server: %s", t.Reason)
+					if game.t1 != nil {
+						game.t1.write(t.Reason)
+					}
+				}
 			case msg.Update:
 				//log.Printf("app.Main event update: %v", t)
 				game.playerTeam = t.Team
+				if t.Team == msg.TeamSpectator {
+					game.playerTeam = 0 // spectator watches from team 0 side
+				}
 				game.playerFuel = t.Fuel
 				game.updateInterval = t.Interval
+				if t.Rules != nil {
+					game.rules = *t.Rules // rules changed by server
+				}
+
+				game.paused = t.Paused
+				if t.Notice != "" {
+					game.notice = t.Notice
+					game.noticeUntil = time.Now().Add(5 * time.Second)
+				}
 
 				game.updateLast = time.Now()
 				elap := time.Since(game.updateLast)
 
+				if t.Round != game.round {
+					// new round resets the world, forget old positions
+					game.round = t.Round
+					game.missiles = map[int]*msg.Missile{}
+					game.cannons = map[int]*msg.Cannon{}
+					game.explosions = nil
+				}
+
+				for _, i := range t.Intercepts {
+					game.explosions = append(game.explosions, explosion{intercept: i, until: time.Now().Add(explosionDuration)})
+				}
+
+				// items are sent at Start, move them to server time Now.
+				// elapsed time is measured in server clock, thus clocks need no sync.
+				for _, m := range t.WorldMissiles {
+					m.CoordY = future.MissileY(m.CoordY, m.Speed, t.Now.Sub(m.Start))
+				}
+				for _, c := range t.Cannons {
+					c.CoordX, c.Speed = future.CannonX(c.CoordX, c.Speed, t.Now.Sub(c.Start))
+				}
+
 				missiles := map[int]*msg.Missile{}
 				for _, m := range t.WorldMissiles {
 					old, found := game.missiles[m.ID]
@@ -384,11 +483,17 @@ func main() {
 				}
 				game.cannons = cannons
 
-				game.t1.write(fmt.Sprintf("%f", t.Fuel))
+				game.lastUpdate = t
+				game.writeStatus()
 
 				var our, their string
-				our = strconv.Itoa(t.Scores[t.Team])
-				their = strconv.Itoa(t.Scores[1-t.Team])
+				if t.Team == msg.TeamSpectator {
+					our = strconv.Itoa(t.Scores[0])
+					their = strconv.Itoa(t.Scores[1])
+				} else {
+					our = strconv.Itoa(t.Scores[t.Team])
+					their = strconv.Itoa(t.Scores[1-t.Team])
+				}
 				game.scoreOur.write(our)
 				game.scoreTheir.write(their)
 
@@ -404,6 +509,61 @@ func main() {
 	log.Print("main end")
 }
 
+// writeStatus shows the admin notice, otherwise the match status.
+// The text is rendered only when changed.
+func (game *gameState) writeStatus() {
+	if game.t1 == nil || game.lastUpdate.Now.IsZero() {
+		return // not visible or no update yet
+	}
+	text := game.notice
+	if !time.Now().Before(game.noticeUntil) {
+		text = matchStatus(game.lastUpdate, time.Since(game.updateLast), game.rules.FuelRecharge)
+	}
+	if text == game.status {
+		return
+	}
+	game.status = text
+	game.t1.write(text)
+}
+
+// matchStatus reports fuel while playing, otherwise the match phase.
+// Countdowns and fuel are extrapolated for elap since the update t.
+func matchStatus(t msg.Update, elap time.Duration, fuelRecharge float32) string {
+	if t.Paused {
+		return "paused"
+	}
+	if t.Queued > 0 {
+		return fmt.Sprintf("queue position %d", t.Queued)
+	}
+	now := t.Now.Add(elap) // server clock
+	for _, c := range t.Cannons {
+		if c.Player && c.Respawn.After(now) && t.Match == msg.MatchPlaying {
+			return fmt.Sprintf("respawn in %.0fs", c.Respawn.Sub(now).Seconds())
+		}
+	}
+	switch t.Match {
+	case msg.MatchLobby:
+		return "waiting for players"
+	case msg.MatchCountdown:
+		left := t.MatchLeft - elap
+		if left < 0 {
+			left = 0
+		}
+		return fmt.Sprintf("round %d in %.0fs", t.Round, left.Seconds())
+	case msg.MatchOver:
+		switch {
+		case t.Winner == msg.WinnerDraw:
+			return "draw"
+		case t.Team == msg.TeamSpectator:
+			return fmt.Sprintf("team %d wins", t.Winner)
+		case t.Winner == t.Team:
+			return "you win"
+		}
+		return "you lose"
+	}
+	return fmt.Sprintf("%f", future.FuelRecharge(t.Fuel, fuelRecharge, elap))
+}
+
 func loadFull(name string) ([]byte, error) {
 	f, errOpen := asset.Open(name)
 	if errOpen != nil {
@@ -556,6 +716,7 @@ func (game *gameState) start(glc gl.Context) {
 
 	game.t1 = newText(game.atlas)
 	game.t1.write("invader")
+	game.status = "invader"
 	game.scoreOur = newText(game.atlas)
 	game.scoreOur.write("?")
 	game.scoreTheir = newText(game.atlas)
@@ -18,6 +18,9 @@ func (game *gameState) paint() {
 	glc := game.gl // shortcut
 
 	elap := time.Since(game.updateLast)
+	if game.paused {
+		elap = 0 // world paused by server, items hold still
+	}
 
 	glc.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
@@ -63,8 +66,8 @@ func (game *gameState) paint() {
 	game.drawWireRect(fuelBarR, .5, .9, .5, 1, .1)
 
 	// Fuel bar
-	fuel := float64(future.Fuel(game.playerFuel, elap))
-	fuelR := unit.Rect{X1: game.minX, Y1: fuelBottom, X2: game.minX + screenWidth*fuel/10, Y2: fuelBottom + fuelHeight}
+	fuel := float64(future.FuelRecharge(game.playerFuel, game.rules.FuelRecharge, elap))
+	fuelR := unit.Rect{X1: game.minX, Y1: fuelBottom, X2: game.minX + screenWidth*fuel/float64(future.FuelMax), Y2: fuelBottom + fuelHeight}
 	game.drawRect(fuelR, .9, .9, .9, 1, 0)
 
 	cannonBottom := fuelBottom + fuelHeight + .01
@@ -74,6 +77,8 @@ func (game *gameState) paint() {
 		switch {
 		case can.Life <= 0:
 			glc.Uniform4f(game.color, .9, .2, .2, 1) // red - dead
+		case can.Invulnerable:
+			glc.Uniform4f(game.color, .9, .9, .2, 1) // yellow - just respawned
 		case can.Player:
 			glc.Uniform4f(game.color, .2, .2, .8, 1) // blue - player
 		default:
@@ -119,6 +124,31 @@ func (game *gameState) paint() {
 		}
 	}
 
+	// Explosions of intercepted missiles, growing while fading
+	glc.Enable(gl.BLEND)
+	glc.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	explosions := game.explosions[:0]
+	for _, e := range game.explosions {
+		left := time.Until(e.until)
+		if left <= 0 {
+			continue // expired
+		}
+		explosions = append(explosions, e)
+
+		up := e.intercept.Team == game.playerTeam
+		r := unit.MissileBox(game.minX, game.maxX, float64(e.intercept.CoordX), float64(e.intercept.CoordY), fieldTop, cannonBottom, game.cannonWidth, game.cannonHeight, game.missileWidth, game.missileHeight, up)
+
+		fade := left.Seconds() / explosionDuration.Seconds()
+		grow := game.missileWidth * (1 - fade)
+		r.X1 -= grow
+		r.X2 += grow
+		r.Y1 -= grow
+		r.Y2 += grow
+		game.drawRect(r, .9, .6, .2, float32(fade), .05)
+	}
+	game.explosions = explosions
+	glc.Disable(gl.BLEND)
+
 	glc.DisableVertexAttribArray(game.position)
 
 	game.paintTex(glc, elap, buttonWidth, buttonHeight, scoreTop, scoreBarHeight, fieldTop, cannonBottom) // another shader
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"encoding/gob"
+	"bufio"
+	"fmt"
 	"log"
 	"net"
 	"strconv"
@@ -14,7 +15,7 @@ import (
 	"github.com/udhos/fugo/msg"
 )
 
-func serverHandler(a app.App, serverAddr string, output <-chan msg.Button) {
+func serverHandler(a app.App, serverAddr string, hello msg.Hello, output <-chan msg.Button) {
 	log.Printf("serverHandler: starting %s", serverAddr)
 
 	// the reconnect loop switches between trying to connect to:
@@ -44,11 +45,29 @@ func serverHandler(a app.App, serverAddr string, output <-chan msg.Button) {
 			log.Printf("serverHandler: error %s: %v", server, errDial)
 		} else {
 			log.Printf("serverHandler: connected %s", server)
-			quitWriter := make(chan struct{})
-			go writeLoop(conn, quitWriter, output) // spawn writer
-			readLoop(a, conn)                      // loop reader
-			conn.Close()
-			close(quitWriter)
+			// handshake uses our preferred codec, then switch to codec chosen by server.
+			// gob decoder reads from bufio.Reader without further buffering,
+			// thus codec decoder can continue from the same reader.
+			r := bufio.NewReader(conn)
+			hsCodec := msg.NegotiateCodec(hello.Codecs)
+			welcome, errHandshake := handshake(conn, hsCodec.NewDecoder(r), hsCodec.NewEncoder(conn), hsCodec.Name(), hello)
+			if errHandshake != nil {
+				log.Printf("serverHandler: handshake %s: %v", server, errHandshake)
+				conn.Close()
+			} else {
+				a.Send(welcome)
+				codec := msg.NegotiateCodec([]string{welcome.Codec})
+				if welcome.Accepted {
+					log.Printf("serverHandler: codec=%s", codec.Name())
+					hello.ResumeToken = welcome.ResumeToken // resume same cannon on reconnect
+					quitWriter := make(chan struct{})
+					acks := make(chan msg.Ack, 1)
+					go writeLoop(codec.NewEncoder(conn), quitWriter, output, acks) // spawn writer
+					readLoop(a, codec.NewDecoder(r), acks)                         // loop reader
+					close(quitWriter)
+				}
+				conn.Close()
+			}
 		}
 
 		time.Sleep(2 * time.Second) // reconnect delay - do not hammer the server
@@ -102,9 +121,11 @@ func request() (string, error) {
 		return "", errRead
 	}
 
-	listen := strings.TrimSpace(string(buf[:n]))
+	// first line is listen address, then one line per room: name clients
+	lines := strings.Split(strings.TrimSpace(string(buf[:n])), "\n")
+	listen := strings.TrimSpace(lines[0])
 
-	log.Printf("discovery response received: src=%s listen=%s", src.String(), listen)
+	log.Printf("discovery response received: src=%s listen=%s rooms=%q", src.String(), listen, lines[1:])
 
 	srcAddr, errSrc := net.ResolveUDPAddr("udp", src.String())
 	if errSrc != nil {
@@ -132,36 +153,107 @@ func request() (string, error) {
 	return endpoint, nil
 }
 
-func readLoop(a app.App, conn net.Conn) {
+func handshake(conn net.Conn, dec msg.Decoder, enc msg.Encoder, codec string, hello msg.Hello) (msg.Welcome, error) {
+	var welcome msg.Welcome
+
+	if errPreamble := msg.WritePreamble(conn, codec); errPreamble != nil {
+		return welcome, errPreamble
+	}
+	if errEnc := enc.Encode(hello); errEnc != nil {
+		return welcome, errEnc
+	}
+
+	if errSet := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); errSet != nil {
+		return welcome, errSet
+	}
+	m, errDec := dec.Decode()
+	if errDec != nil {
+		return welcome, errDec
+	}
+	welcome, isWelcome := m.(msg.Welcome)
+	if !isWelcome {
+		return welcome, fmt.Errorf("expected welcome, got %T", m)
+	}
+	if errSet := conn.SetReadDeadline(time.Time{}); errSet != nil {
+		return welcome, errSet
+	}
+
+	log.Printf("handshake: server version=%s protocol=%d accepted=%v reason=[%s] room=%s rooms=%v", welcome.Version, welcome.Protocol, welcome.Accepted, welcome.Reason, welcome.Room, welcome.Rooms)
+
+	return welcome, nil
+}
+
+func readLoop(a app.App, dec msg.Decoder, acks chan msg.Ack) {
 	log.Printf("readLoop: entering")
 	// copy from socket into event channel
-	dec := gob.NewDecoder(conn)
+	states := map[int]msg.State{} // received states by update seq
+LOOP:
 	for {
-		var m msg.Update
-		if err := dec.Decode(&m); err != nil {
+		m, err := dec.Decode()
+		if err != nil {
 			log.Printf("readLoop: Decode: %v", err)
 			break
 		}
-		a.Send(m)
+		u, isUpdate := m.(msg.Update)
+		if !isUpdate {
+			a.Send(m)
+			continue
+		}
+
+		// rebuild full update from delta
+		var s msg.State
+		if u.Full {
+			s = msg.NewState(u)
+		} else {
+			base, found := states[u.Base]
+			if !found {
+				log.Printf("readLoop: update seq=%d: base=%d not found", u.Seq, u.Base)
+				break LOOP
+			}
+			s = base.Apply(u)
+		}
+		states[u.Seq] = s
+		for seq := range states {
+			if seq < u.Base {
+				delete(states, seq) // server will never use older base
+			}
+		}
+		s.Fill(&u)
+
+		ack(acks, u.Seq)
+
+		a.Send(u)
 	}
 	log.Printf("readLoop: exiting")
 }
 
-func writeLoop(conn net.Conn, quit <-chan struct{}, output <-chan msg.Button) {
+// ack queues acknowledgement for the writer, replacing any older pending ack.
+func ack(acks chan msg.Ack, seq int) {
+	select {
+	case <-acks:
+	default:
+	}
+	acks <- msg.Ack{Seq: seq}
+}
+
+func writeLoop(enc msg.Encoder, quit <-chan struct{}, output <-chan msg.Button, acks <-chan msg.Ack) {
 	log.Printf("writeLoop: goroutine starting")
 	// copy from output channel into socket
-	enc := gob.NewEncoder(conn)
 LOOP:
 	for {
+		var m interface{}
 		select {
 		case <-quit:
 			log.Printf("writeLoop: quit request")
 			break LOOP
-		case m := <-output:
-			if err := enc.Encode(&m); err != nil {
-				log.Printf("writeLoop: Encode: %v", err)
-				break LOOP
-			}
+		case b := <-output:
+			m = b
+		case a := <-acks:
+			m = a
+		}
+		if err := enc.Encode(m); err != nil {
+			log.Printf("writeLoop: Encode: %v", err)
+			break LOOP
 		}
 	}
 	log.Printf("writeLoop: goroutine exiting")
@@ -1,17 +1,26 @@
 package future
 
 import (
+	"math"
 	"time"
 )
 
 // FuelRechargeRate is number of units recharged per second.
 const FuelRechargeRate = float32(1.0 / 3.0) // 1 unit every 3 seconds
 
-// Fuel calculates new value after elap delta time interval. 0.0 to 10.0
+// FuelMax is the full tank.
+const FuelMax = float32(10)
+
+// Fuel calculates new value after elap delta time interval. 0.0 to FuelMax
 func Fuel(initial float32, elap time.Duration) float32 {
-	fuel := initial + FuelRechargeRate*float32(elap)/float32(time.Second)
-	if fuel > 10 {
-		fuel = 10
+	return FuelRecharge(initial, FuelRechargeRate, elap)
+}
+
+// FuelRecharge calculates new value after elap delta time interval, recharging rate units per second. 0.0 to FuelMax
+func FuelRecharge(initial float32, rate float32, elap time.Duration) float32 {
+	fuel := initial + rate*float32(elap)/float32(time.Second)
+	if fuel > FuelMax {
+		fuel = FuelMax
 	}
 	return fuel
 }
@@ -38,3 +47,28 @@ func MissileY(initial float32, rate float32, elap time.Duration) float32 {
 	}
 	return y
 }
+
+// Never is returned for events that do not happen.
+const Never = time.Duration(math.MaxInt64)
+
+// MissileTop calculates the time for missile to reach the top (1.0).
+func MissileTop(initial float32, rate float32) time.Duration {
+	if initial >= 1 {
+		return 0
+	}
+	if rate <= 0 {
+		return Never
+	}
+	return time.Duration(float64(1-initial) / float64(rate) * float64(time.Second))
+}
+
+// CannonBounce calculates the time for cannon to reach the border (0.0 or 1.0), where it bounces.
+func CannonBounce(initial float32, rate float32) time.Duration {
+	switch {
+	case rate > 0:
+		return time.Duration(float64(1-initial) / float64(rate) * float64(time.Second))
+	case rate < 0:
+		return time.Duration(float64(initial) / float64(-rate) * float64(time.Second))
+	}
+	return Never
+}
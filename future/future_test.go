@@ -18,6 +18,27 @@ func TestCannonX(t *testing.T) {
 	cannonX(t, .1, .5, time.Second, .6)
 }
 
+func TestMissileTop(t *testing.T) {
+	if d := MissileTop(.5, .25); d != 2*time.Second {
+		t.Errorf("missileTop: expected=2s result=%v", d)
+	}
+	if d := MissileTop(.5, 0); d != Never {
+		t.Errorf("missileTop: still missile: expected=never result=%v", d)
+	}
+}
+
+func TestCannonBounce(t *testing.T) {
+	if d := CannonBounce(.5, .25); d != 2*time.Second {
+		t.Errorf("cannonBounce: right: expected=2s result=%v", d)
+	}
+	if d := CannonBounce(.5, -.5); d != time.Second {
+		t.Errorf("cannonBounce: left: expected=1s result=%v", d)
+	}
+	if d := CannonBounce(.5, 0); d != Never {
+		t.Errorf("cannonBounce: still cannon: expected=never result=%v", d)
+	}
+}
+
 func cannonX(t *testing.T, initial, rate float32, elap time.Duration, expected float32) {
 	x, _ := CannonX(initial, rate, elap)
 	if x != expected {
@@ -0,0 +1,553 @@
+package msg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Binary codec frame: 4-byte big-endian payload length, then payload.
+// Payload: 1-byte message type, then message fields in declaration order.
+// See docs/binary_protocol.md.
+
+// BinaryFrameMax is the largest binary payload accepted by the decoder.
+const BinaryFrameMax = 1 << 20
+
+// Binary message types.
+const (
+	binaryUpdate  = 1
+	binaryButton  = 2
+	binaryAck     = 3
+	binaryHello   = 4
+	binaryWelcome = 5
+)
+
+var errShortFrame = errors.New("binary codec: short frame")
+
+// ErrFrameTooBig reports a frame header beyond the decoder limit.
+// The frame is rejected before its payload is allocated.
+var ErrFrameTooBig = errors.New("binary codec: frame too big")
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return CodecBinary
+}
+
+func (binaryCodec) NewEncoder(w io.Writer) Encoder {
+	return &binaryEncoder{w: w}
+}
+
+func (binaryCodec) NewDecoder(r io.Reader) Decoder {
+	return &binaryDecoder{r: r, max: BinaryFrameMax}
+}
+
+// NewDecoderLimit creates a decoder rejecting frames larger than max bytes, at most BinaryFrameMax.
+func (binaryCodec) NewDecoderLimit(r io.Reader, max int) Decoder {
+	if max > BinaryFrameMax {
+		max = BinaryFrameMax
+	}
+	return &binaryDecoder{r: r, max: max}
+}
+
+type binaryEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (e *binaryEncoder) Encode(m interface{}) error {
+	b := e.buf[:0]
+	b = append(b, 0, 0, 0, 0) // room for length
+
+	switch v := m.(type) {
+	case Update:
+		b = append(b, binaryUpdate)
+		b = putUpdate(b, &v)
+	case *Update:
+		b = append(b, binaryUpdate)
+		b = putUpdate(b, v)
+	case Button:
+		b = append(b, binaryButton)
+		b = putInt(b, v.ID)
+	case Ack:
+		b = append(b, binaryAck)
+		b = putInt(b, v.Seq)
+	case Hello:
+		b = append(b, binaryHello)
+		b = putHello(b, &v)
+	case Welcome:
+		b = append(b, binaryWelcome)
+		b = putWelcome(b, &v)
+	default:
+		return fmt.Errorf("binary codec: unsupported message type %T", m)
+	}
+
+	size := len(b) - 4
+	if size > BinaryFrameMax {
+		return fmt.Errorf("binary codec: frame size %d exceeds %d", size, BinaryFrameMax)
+	}
+	binary.BigEndian.PutUint32(b, uint32(size))
+	e.buf = b
+
+	_, err := e.w.Write(b)
+	return err
+}
+
+type binaryDecoder struct {
+	r   io.Reader
+	buf []byte
+	max int // frame size
+}
+
+func (d *binaryDecoder) Decode() (interface{}, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(d.max) {
+		return nil, fmt.Errorf("%w: size %d exceeds %d", ErrFrameTooBig, size, d.max)
+	}
+	if cap(d.buf) < int(size) {
+		d.buf = make([]byte, size)
+	}
+	b := d.buf[:size]
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, err
+	}
+
+	r := binaryReader{buf: b}
+	var m interface{}
+
+	switch t := r.byte(); t {
+	case binaryUpdate:
+		m = r.update()
+	case binaryButton:
+		m = Button{ID: r.int()}
+	case binaryAck:
+		m = Ack{Seq: r.int()}
+	case binaryHello:
+		m = r.hello()
+	case binaryWelcome:
+		m = r.welcome()
+	default:
+		if r.err == nil {
+			return nil, fmt.Errorf("binary codec: unknown message type %d", t)
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.buf) > 0 {
+		return nil, fmt.Errorf("binary codec: %d trailing bytes", len(r.buf))
+	}
+
+	return m, nil
+}
+
+func putHello(b []byte, h *Hello) []byte {
+	b = putString(b, h.Version)
+	b = putInt(b, h.Protocol)
+	b = putString(b, h.PlayerID)
+	b = putString(b, h.Name)
+	b = putString(b, h.ResumeToken)
+	b = putStrings(b, h.Codecs)
+	b = putBool(b, h.Spectator)
+	b = putString(b, h.Room)
+	b = putBool(b, h.ListRooms)
+	return b
+}
+
+func putWelcome(b []byte, w *Welcome) []byte {
+	b = putString(b, w.Version)
+	b = putInt(b, w.Protocol)
+	b = putBool(b, w.Accepted)
+	b = putString(b, w.Reason)
+	b = putString(b, w.ResumeToken)
+	b = putBool(b, w.Resumed)
+	b = putString(b, w.Codec)
+	b = putRules(b, &w.Rules)
+	b = putString(b, w.Room)
+	b = putUvarint(b, uint64(len(w.Rooms)))
+	for _, room := range w.Rooms {
+		b = putString(b, room.Name)
+		b = putInt(b, room.Clients)
+	}
+	return b
+}
+
+func putUpdate(b []byte, u *Update) []byte {
+	b = putFloat32(b, u.Fuel)
+	b = putInt64(b, int64(u.Interval))
+	b = putUvarint(b, uint64(len(u.WorldMissiles)))
+	for _, m := range u.WorldMissiles {
+		b = putMissile(b, m)
+	}
+	b = putUvarint(b, uint64(len(u.Cannons)))
+	for _, c := range u.Cannons {
+		b = putCannon(b, c)
+	}
+	b = putInt(b, u.Team)
+	b = putInt(b, u.Scores[0])
+	b = putInt(b, u.Scores[1])
+	b = putBool(b, u.FireSound)
+	b = putInt(b, u.Seq)
+	b = putInt(b, u.Base)
+	b = putBool(b, u.Full)
+	b = putInts(b, u.RemovedMissiles)
+	b = putInts(b, u.RemovedCannons)
+	b = putInt(b, u.Match)
+	b = putInt64(b, int64(u.MatchLeft))
+	b = putInt(b, u.Round)
+	b = putInt(b, u.Winner)
+	b = putBool(b, u.Rules != nil)
+	if u.Rules != nil {
+		b = putRules(b, u.Rules)
+	}
+	b = putInt(b, u.Queued)
+	b = putTime(b, u.Now)
+	b = putBool(b, u.Paused)
+	b = putString(b, u.Notice)
+	b = putUvarint(b, uint64(len(u.Intercepts)))
+	for _, i := range u.Intercepts {
+		b = putIntercept(b, i)
+	}
+	return b
+}
+
+func putRules(b []byte, r *Rules) []byte {
+	b = putFloat32(b, r.MissileSpeed)
+	b = putFloat32(b, r.CannonSpeed)
+	b = putFloat32(b, r.MissileDamage)
+	b = putFloat32(b, r.FuelCost)
+	b = putFloat32(b, r.FuelRecharge)
+	b = putFloat32(b, r.FuelStart)
+	b = putBool(b, r.MissileIntercept)
+	return b
+}
+
+func putMissile(b []byte, m *Missile) []byte {
+	b = putInt(b, m.ID)
+	b = putFloat32(b, m.CoordX)
+	b = putFloat32(b, m.CoordY)
+	b = putFloat32(b, m.Speed)
+	b = putInt(b, m.Team)
+	b = putTime(b, m.Start)
+	return b
+}
+
+func putIntercept(b []byte, i *Intercept) []byte {
+	b = putFloat32(b, i.CoordX)
+	b = putFloat32(b, i.CoordY)
+	b = putInt(b, i.Team)
+	return b
+}
+
+func putCannon(b []byte, c *Cannon) []byte {
+	b = putInt(b, c.ID)
+	b = putTime(b, c.Start)
+	b = putFloat32(b, c.CoordX)
+	b = putFloat32(b, c.Speed)
+	b = putInt(b, c.Team)
+	b = putBool(b, c.Player)
+	b = putFloat32(b, c.Life)
+	b = putTime(b, c.Respawn)
+	b = putBool(b, c.Invulnerable)
+	return b
+}
+
+func putUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+func putInt64(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+func putInt(b []byte, v int) []byte {
+	return putInt64(b, int64(v))
+}
+
+func putInts(b []byte, v []int) []byte {
+	b = putUvarint(b, uint64(len(v)))
+	for _, i := range v {
+		b = putInt(b, i)
+	}
+	return b
+}
+
+func putString(b []byte, v string) []byte {
+	b = putUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func putStrings(b []byte, v []string) []byte {
+	b = putUvarint(b, uint64(len(v)))
+	for _, s := range v {
+		b = putString(b, s)
+	}
+	return b
+}
+
+func putFloat32(b []byte, v float32) []byte {
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], math.Float32bits(v))
+	return append(b, tmp[:]...)
+}
+
+func putBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// putTime encodes nanoseconds since Unix epoch. Zero time is encoded as 0.
+func putTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return putInt64(b, 0)
+	}
+	return putInt64(b, t.UnixNano())
+}
+
+// binaryReader consumes buf. The first error sticks, later reads return zero values.
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.buf = nil
+}
+
+func (r *binaryReader) byte() byte {
+	if len(r.buf) < 1 {
+		r.fail(errShortFrame)
+		return 0
+	}
+	v := r.buf[0]
+	r.buf = r.buf[1:]
+	return v
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail(errShortFrame)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) int64() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail(errShortFrame)
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) int() int {
+	return int(r.int64())
+}
+
+// count reads a slice length, refusing lengths that cannot fit the remaining frame.
+func (r *binaryReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		r.fail(errShortFrame)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binaryReader) ints() []int {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	v := make([]int, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		v = append(v, r.int())
+	}
+	return v
+}
+
+func (r *binaryReader) string() string {
+	n := r.count()
+	v := string(r.buf[:n])
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binaryReader) strings() []string {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	v := make([]string, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		v = append(v, r.string())
+	}
+	return v
+}
+
+func (r *binaryReader) float32() float32 {
+	if len(r.buf) < 4 {
+		r.fail(errShortFrame)
+		return 0
+	}
+	v := math.Float32frombits(binary.BigEndian.Uint32(r.buf))
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *binaryReader) bool() bool {
+	return r.byte() != 0
+}
+
+func (r *binaryReader) time() time.Time {
+	nano := r.int64()
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+func (r *binaryReader) hello() Hello {
+	var h Hello
+	h.Version = r.string()
+	h.Protocol = r.int()
+	h.PlayerID = r.string()
+	h.Name = r.string()
+	h.ResumeToken = r.string()
+	h.Codecs = r.strings()
+	h.Spectator = r.bool()
+	h.Room = r.string()
+	h.ListRooms = r.bool()
+	return h
+}
+
+func (r *binaryReader) welcome() Welcome {
+	var w Welcome
+	w.Version = r.string()
+	w.Protocol = r.int()
+	w.Accepted = r.bool()
+	w.Reason = r.string()
+	w.ResumeToken = r.string()
+	w.Resumed = r.bool()
+	w.Codec = r.string()
+	w.Rules = *r.rules()
+	w.Room = r.string()
+	if n := r.count(); n > 0 {
+		w.Rooms = make([]Room, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			w.Rooms = append(w.Rooms, Room{Name: r.string(), Clients: r.int()})
+		}
+	}
+	return w
+}
+
+func (r *binaryReader) update() Update {
+	var u Update
+	u.Fuel = r.float32()
+	u.Interval = time.Duration(r.int64())
+	if n := r.count(); n > 0 {
+		u.WorldMissiles = make([]*Missile, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			u.WorldMissiles = append(u.WorldMissiles, r.missile())
+		}
+	}
+	if n := r.count(); n > 0 {
+		u.Cannons = make([]*Cannon, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			u.Cannons = append(u.Cannons, r.cannon())
+		}
+	}
+	u.Team = r.int()
+	u.Scores[0] = r.int()
+	u.Scores[1] = r.int()
+	u.FireSound = r.bool()
+	u.Seq = r.int()
+	u.Base = r.int()
+	u.Full = r.bool()
+	u.RemovedMissiles = r.ints()
+	u.RemovedCannons = r.ints()
+	u.Match = r.int()
+	u.MatchLeft = time.Duration(r.int64())
+	u.Round = r.int()
+	u.Winner = r.int()
+	if r.bool() {
+		u.Rules = r.rules()
+	}
+	u.Queued = r.int()
+	u.Now = r.time()
+	u.Paused = r.bool()
+	u.Notice = r.string()
+	if n := r.count(); n > 0 {
+		u.Intercepts = make([]*Intercept, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			u.Intercepts = append(u.Intercepts, r.intercept())
+		}
+	}
+	return u
+}
+
+func (r *binaryReader) rules() *Rules {
+	var rl Rules
+	rl.MissileSpeed = r.float32()
+	rl.CannonSpeed = r.float32()
+	rl.MissileDamage = r.float32()
+	rl.FuelCost = r.float32()
+	rl.FuelRecharge = r.float32()
+	rl.FuelStart = r.float32()
+	rl.MissileIntercept = r.bool()
+	return &rl
+}
+
+func (r *binaryReader) missile() *Missile {
+	var m Missile
+	m.ID = r.int()
+	m.CoordX = r.float32()
+	m.CoordY = r.float32()
+	m.Speed = r.float32()
+	m.Team = r.int()
+	m.Start = r.time()
+	return &m
+}
+
+func (r *binaryReader) intercept() *Intercept {
+	var i Intercept
+	i.CoordX = r.float32()
+	i.CoordY = r.float32()
+	i.Team = r.int()
+	return &i
+}
+
+func (r *binaryReader) cannon() *Cannon {
+	var c Cannon
+	c.ID = r.int()
+	c.Start = r.time()
+	c.CoordX = r.float32()
+	c.Speed = r.float32()
+	c.Team = r.int()
+	c.Player = r.bool()
+	c.Life = r.float32()
+	c.Respawn = r.time()
+	c.Invulnerable = r.bool()
+	return &c
+}
@@ -0,0 +1,158 @@
+package msg
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Encoder writes messages into a stream.
+type Encoder interface {
+	Encode(m interface{}) error
+}
+
+// Decoder reads messages from a stream.
+type Decoder interface {
+	Decode() (interface{}, error)
+}
+
+// Codec is a wire format for messages.
+// The client picks the codec for the handshake (Hello, Welcome) with the preamble,
+// then Welcome.Codec is used for every later message. See WritePreamble.
+type Codec interface {
+	Name() string
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+	NewDecoderLimit(r io.Reader, max int) Decoder // for untrusted peers, see ErrFrameTooBig
+}
+
+// Codec names.
+const (
+	CodecGob    = "gob"
+	CodecBinary = "binary"
+)
+
+var codecs = []Codec{
+	binaryCodec{},
+	gobCodec{},
+}
+
+// CodecNames lists supported codecs in preference order.
+func CodecNames() []string {
+	var names []string
+	for _, c := range codecs {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// FindCodec returns nil if the codec is not supported.
+func FindCodec(name string) Codec {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// NegotiateCodec picks the first codec from the peer preference list that is supported.
+// Peers not reporting codecs speak gob.
+func NegotiateCodec(peerCodecs []string) Codec {
+	for _, name := range peerCodecs {
+		if c := FindCodec(name); c != nil {
+			return c
+		}
+	}
+	return gobCodec{}
+}
+
+// PreambleMagic starts the connection: the magic byte, one byte codec name length,
+// then the name of the codec for Hello and Welcome.
+// The magic byte cannot start a gob stream, thus the server tells apart
+// legacy clients sending a gob Hello right away.
+const PreambleMagic = 0xF0
+
+// WritePreamble tells the server the codec used for Hello and Welcome.
+// It is codec neutral, thus clients need only implement the codec they pick.
+func WritePreamble(w io.Writer, codec string) error {
+	if len(codec) > 255 {
+		return fmt.Errorf("preamble: codec name too long: %d", len(codec))
+	}
+	b := append([]byte{PreambleMagic, byte(len(codec))}, codec...)
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadPreamble returns the codec chosen by the client for Hello and Welcome.
+// legacy reports a client without preamble, which sends a gob Hello as plain value.
+func ReadPreamble(r *bufio.Reader) (codec Codec, legacy bool, err error) {
+	magic, errPeek := r.Peek(1)
+	if errPeek != nil {
+		return nil, false, errPeek
+	}
+	if magic[0] != PreambleMagic {
+		return gobCodec{}, true, nil
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, false, err
+	}
+	name := make([]byte, header[1])
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, false, err
+	}
+	codec = FindCodec(string(name))
+	if codec == nil {
+		return nil, false, fmt.Errorf("preamble: unsupported codec: %q", name)
+	}
+	return codec, false, nil
+}
+
+func init() {
+	gob.Register(Update{})
+	gob.Register(Button{})
+	gob.Register(Ack{})
+	gob.Register(Hello{})
+	gob.Register(Welcome{})
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return CodecGob
+}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder {
+	return gobEncoder{gob.NewEncoder(w)}
+}
+
+func (gobCodec) NewDecoder(r io.Reader) Decoder {
+	return gobDecoder{gob.NewDecoder(r)}
+}
+
+// NewDecoderLimit ignores max: gob reads large messages in chunks,
+// thus the reader itself should enforce the limit.
+func (c gobCodec) NewDecoderLimit(r io.Reader, max int) Decoder {
+	return c.NewDecoder(r)
+}
+
+type gobEncoder struct {
+	enc *gob.Encoder
+}
+
+// Encode sends m as interface value, thus the peer can decode any registered type.
+func (e gobEncoder) Encode(m interface{}) error {
+	return e.enc.Encode(&m)
+}
+
+type gobDecoder struct {
+	dec *gob.Decoder
+}
+
+func (d gobDecoder) Decode() (interface{}, error) {
+	var m interface{}
+	err := d.dec.Decode(&m)
+	return m, err
+}
@@ -0,0 +1,135 @@
+package msg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	start := time.Unix(0, time.Now().UnixNano()) // drop monotonic clock and location
+
+	messages := []interface{}{
+		Button{ID: ButtonTurn},
+		Ack{Seq: 42},
+		Hello{Version: "v1", Protocol: Protocol, PlayerID: "id", Name: "name", ResumeToken: "token", Codecs: []string{CodecBinary, CodecGob}, Spectator: true, Room: "room", ListRooms: true},
+		Welcome{Version: "v2", Protocol: Protocol, Accepted: true, Reason: "reason", ResumeToken: "token", Resumed: true, Codec: CodecBinary,
+			Rules: Rules{MissileSpeed: .5, FuelStart: 5, MissileIntercept: true}, Room: "main", Rooms: []Room{{Name: "main", Clients: 2}, {Name: "other"}}},
+		Update{
+			Fuel:     3.5,
+			Interval: time.Second,
+			WorldMissiles: []*Missile{
+				{ID: 7, CoordX: .3, CoordY: .4, Speed: .5, Team: 1, Start: start},
+			},
+			Cannons: []*Cannon{
+				{ID: 2, Start: start, CoordX: .6, Speed: -.15, Team: 1, Player: true, Life: .75},
+				{ID: 3, Start: start, CoordX: .1, Speed: .15, Life: 1, Invulnerable: true},
+				{ID: 4, Start: start, CoordX: .2, Respawn: start.Add(2 * time.Second)},
+			},
+			Team:            1,
+			Scores:          [2]int{3, 4},
+			FireSound:       true,
+			Seq:             10,
+			Base:            8,
+			RemovedMissiles: []int{5, 6},
+			RemovedCannons:  []int{-1},
+			Match:           MatchOver,
+			MatchLeft:       3 * time.Second,
+			Round:           2,
+			Winner:          WinnerDraw,
+			Rules:           &Rules{MissileSpeed: .5, CannonSpeed: .15, MissileDamage: .25, FuelCost: 1, FuelRecharge: .3, FuelStart: 5, MissileIntercept: true},
+			Queued:          3,
+			Now:             start.Add(time.Second),
+			Paused:          true,
+			Notice:          "server restarts in 5 minutes",
+			Intercepts:      []*Intercept{{CoordX: .3, CoordY: .45, Team: 0}},
+		},
+	}
+
+	for _, name := range CodecNames() {
+		c := FindCodec(name)
+		var buf bytes.Buffer
+		enc := c.NewEncoder(&buf)
+		for _, m := range messages {
+			if err := enc.Encode(m); err != nil {
+				t.Fatalf("%s: encode %T: %v", name, m, err)
+			}
+		}
+		t.Logf("%s: %d messages, %d bytes", name, len(messages), buf.Len())
+		dec := c.NewDecoder(&buf)
+		for _, m := range messages {
+			result, err := dec.Decode()
+			if err != nil {
+				t.Fatalf("%s: decode %T: %v", name, m, err)
+			}
+			if !reflect.DeepEqual(m, result) {
+				t.Errorf("%s: expected=%#v result=%#v", name, m, result)
+			}
+		}
+	}
+}
+
+func TestBinaryTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	enc := FindCodec(CodecBinary).NewEncoder(&buf)
+	if err := enc.Encode(Update{Cannons: []*Cannon{{ID: 1}}}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	b := buf.Bytes()
+	b[3]-- // shrink frame length by one byte
+	dec := FindCodec(CodecBinary).NewDecoder(bytes.NewReader(b[:len(b)-1]))
+	if _, err := dec.Decode(); err == nil {
+		t.Errorf("truncated frame decoded without error")
+	}
+}
+
+func TestBinaryFrameLimit(t *testing.T) {
+	header := []byte{0, 0x10, 0, 0} // 1 MiB frame, payload never sent
+	dec := FindCodec(CodecBinary).NewDecoderLimit(bytes.NewReader(header), 4096)
+	if _, err := dec.Decode(); !errors.Is(err, ErrFrameTooBig) {
+		t.Errorf("oversized frame: err=%v", err)
+	}
+	if b := dec.(*binaryDecoder).buf; cap(b) != 0 {
+		t.Errorf("oversized frame allocated: %d bytes", cap(b))
+	}
+}
+
+func TestPreamble(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePreamble(&buf, CodecBinary); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf.WriteString("rest")
+	r := bufio.NewReader(&buf)
+	codec, legacy, err := ReadPreamble(r)
+	if err != nil || legacy || codec.Name() != CodecBinary {
+		t.Errorf("preamble: codec=%v legacy=%v err=%v", codec, legacy, err)
+	}
+	if rest, _ := r.ReadString(0); rest != "rest" {
+		t.Errorf("preamble consumed message bytes: rest=%q", rest)
+	}
+
+	// legacy client sends gob Hello right away, nothing is consumed
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(&Hello{Name: "legacy"}); err != nil {
+		t.Fatalf("gob: %v", err)
+	}
+	r = bufio.NewReader(&buf)
+	if codec, legacy, err := ReadPreamble(r); err != nil || !legacy || codec.Name() != CodecGob {
+		t.Errorf("legacy: codec=%v legacy=%v err=%v", codec, legacy, err)
+	}
+	var hello Hello
+	if err := gob.NewDecoder(r).Decode(&hello); err != nil || hello.Name != "legacy" {
+		t.Errorf("legacy hello: %+v err=%v", hello, err)
+	}
+
+	buf.Reset()
+	WritePreamble(&buf, "bogus")
+	if _, _, err := ReadPreamble(bufio.NewReader(&buf)); err == nil {
+		t.Errorf("unsupported codec accepted")
+	}
+}
@@ -0,0 +1,152 @@
+package msg
+
+import (
+	"sort"
+	"time"
+)
+
+// Ack message is sent from client to server to acknowledge the update Seq.
+// Server builds delta updates relative to the last acknowledged update.
+type Ack struct {
+	Seq int
+}
+
+// State holds the missiles and cannons known by one client.
+// Items are kept by value, so a State is not affected by later world changes.
+type State struct {
+	Missiles map[int]Missile
+	Cannons  map[int]Cannon
+}
+
+// NewState creates a state holding the items from a full update.
+func NewState(u Update) State {
+	s := State{
+		Missiles: make(map[int]Missile, len(u.WorldMissiles)),
+		Cannons:  make(map[int]Cannon, len(u.Cannons)),
+	}
+	for _, m := range u.WorldMissiles {
+		s.Missiles[m.ID] = *m
+	}
+	for _, c := range u.Cannons {
+		s.Cannons[c.ID] = *c
+	}
+	return s
+}
+
+// Fill replaces the update items with the full state.
+func (s State) Fill(u *Update) {
+	u.WorldMissiles = make([]*Missile, 0, len(s.Missiles))
+	for _, id := range sortedKeysMissile(s.Missiles) {
+		m := s.Missiles[id]
+		u.WorldMissiles = append(u.WorldMissiles, &m)
+	}
+	u.Cannons = make([]*Cannon, 0, len(s.Cannons))
+	for _, id := range sortedKeysCannon(s.Cannons) {
+		c := s.Cannons[id]
+		u.Cannons = append(u.Cannons, &c)
+	}
+	u.RemovedMissiles = nil
+	u.RemovedCannons = nil
+}
+
+// Delta replaces the update items with the items created or changed since base,
+// and lists the items removed since base.
+func (s State) Delta(base State, u *Update) {
+	u.WorldMissiles = nil
+	u.RemovedMissiles = nil
+	for _, id := range sortedKeysMissile(s.Missiles) {
+		m := s.Missiles[id]
+		if old, found := base.Missiles[id]; found && missileEqual(old, m) {
+			continue
+		}
+		u.WorldMissiles = append(u.WorldMissiles, &m)
+	}
+	for _, id := range sortedKeysMissile(base.Missiles) {
+		if _, found := s.Missiles[id]; !found {
+			u.RemovedMissiles = append(u.RemovedMissiles, id)
+		}
+	}
+
+	u.Cannons = nil
+	u.RemovedCannons = nil
+	for _, id := range sortedKeysCannon(s.Cannons) {
+		c := s.Cannons[id]
+		if old, found := base.Cannons[id]; found && cannonEqual(old, c) {
+			continue
+		}
+		u.Cannons = append(u.Cannons, &c)
+	}
+	for _, id := range sortedKeysCannon(base.Cannons) {
+		if _, found := s.Cannons[id]; !found {
+			u.RemovedCannons = append(u.RemovedCannons, id)
+		}
+	}
+}
+
+// Apply returns the state resulting from applying the delta update on top of s.
+// s is not modified.
+func (s State) Apply(u Update) State {
+	s1 := State{
+		Missiles: make(map[int]Missile, len(s.Missiles)),
+		Cannons:  make(map[int]Cannon, len(s.Cannons)),
+	}
+	for id, m := range s.Missiles {
+		s1.Missiles[id] = m
+	}
+	for id, c := range s.Cannons {
+		s1.Cannons[id] = c
+	}
+	for _, id := range u.RemovedMissiles {
+		delete(s1.Missiles, id)
+	}
+	for _, id := range u.RemovedCannons {
+		delete(s1.Cannons, id)
+	}
+	for _, m := range u.WorldMissiles {
+		s1.Missiles[m.ID] = *m
+	}
+	for _, c := range u.Cannons {
+		s1.Cannons[c.ID] = *c
+	}
+	return s1
+}
+
+// missileEqual compares Start with time.Time.Equal, other fields with ==.
+func missileEqual(m1, m2 Missile) bool {
+	if !m1.Start.Equal(m2.Start) {
+		return false
+	}
+	m1.Start = time.Time{}
+	m2.Start = time.Time{}
+	return m1 == m2
+}
+
+// cannonEqual compares Start and Respawn with time.Time.Equal, other fields with ==.
+func cannonEqual(c1, c2 Cannon) bool {
+	if !c1.Start.Equal(c2.Start) || !c1.Respawn.Equal(c2.Respawn) {
+		return false
+	}
+	c1.Start = time.Time{}
+	c2.Start = time.Time{}
+	c1.Respawn = time.Time{}
+	c2.Respawn = time.Time{}
+	return c1 == c2
+}
+
+func sortedKeysMissile(m map[int]Missile) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func sortedKeysCannon(m map[int]Cannon) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,73 @@
+package msg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelta(t *testing.T) {
+	now := time.Now()
+
+	baseUpdate := Update{
+		WorldMissiles: []*Missile{
+			{ID: 1, CoordX: .1, Speed: .5, Start: now},
+			{ID: 2, CoordX: .2, Speed: .5, Start: now},
+		},
+		Cannons: []*Cannon{
+			{ID: 1, CoordX: .5, Speed: .15, Start: now, Life: 1},
+			{ID: 2, CoordX: .5, Speed: .15, Start: now, Life: 1, Team: 1},
+			{ID: 4, CoordX: .5, Start: now, Respawn: now.Add(2 * time.Second), Team: 1},
+		},
+	}
+
+	curUpdate := Update{
+		WorldMissiles: []*Missile{
+			{ID: 2, CoordX: .2, Speed: .5, Start: now}, // unchanged
+			{ID: 3, CoordX: .3, Speed: .5, Start: now}, // created
+		},
+		Cannons: []*Cannon{
+			{ID: 1, CoordX: .7, Speed: -.15, Start: now.Add(time.Second), Life: 1},               // changed
+			{ID: 3, CoordX: .5, Speed: .15, Start: now, Life: 1, Team: 1},                        // created
+			{ID: 4, CoordX: .5, Start: now, Respawn: now.Add(2 * time.Second).Round(0), Team: 1}, // destroyed, unchanged
+		},
+	}
+
+	base := NewState(baseUpdate)
+	cur := NewState(curUpdate)
+
+	var delta Update
+	cur.Delta(base, &delta)
+
+	if len(delta.WorldMissiles) != 1 || delta.WorldMissiles[0].ID != 3 {
+		t.Errorf("missiles: %v", delta.WorldMissiles)
+	}
+	if len(delta.RemovedMissiles) != 1 || delta.RemovedMissiles[0] != 1 {
+		t.Errorf("removed missiles: %v", delta.RemovedMissiles)
+	}
+	if len(delta.Cannons) != 2 {
+		t.Errorf("cannons: %v", delta.Cannons)
+	}
+	if len(delta.RemovedCannons) != 1 || delta.RemovedCannons[0] != 2 {
+		t.Errorf("removed cannons: %v", delta.RemovedCannons)
+	}
+
+	result := base.Apply(delta)
+
+	if len(result.Missiles) != len(cur.Missiles) || len(result.Cannons) != len(cur.Cannons) {
+		t.Fatalf("apply: expected=%v result=%v", cur, result)
+	}
+	for id, m := range cur.Missiles {
+		if !missileEqual(m, result.Missiles[id]) {
+			t.Errorf("apply missile %d: expected=%v result=%v", id, m, result.Missiles[id])
+		}
+	}
+	for id, c := range cur.Cannons {
+		if !cannonEqual(c, result.Cannons[id]) {
+			t.Errorf("apply cannon %d: expected=%v result=%v", id, c, result.Cannons[id])
+		}
+	}
+
+	if len(base.Missiles) != 2 || len(base.Cannons) != 3 {
+		t.Errorf("apply modified base: %v", base)
+	}
+}
@@ -4,15 +4,100 @@ import (
 	"time"
 )
 
+// Protocol is the wire protocol version.
+// Increase it whenever messages change incompatibly.
+const Protocol = 12
+
+// Hello message is sent from client to server right after connecting.
+type Hello struct {
+	Version     string   // client version
+	Protocol    int      // client wire protocol version
+	PlayerID    string   // persistent player identity
+	Name        string   // requested player name
+	ResumeToken string   // token from previous Welcome, to resume the same cannon
+	Codecs      []string // codecs supported by client, in preference order
+	Spectator   bool     // watch the match without owning a cannon
+	Room        string   // room to join, created if missing. Empty means DefaultRoom
+	ListRooms   bool     // only ask for Welcome.Rooms, server closes connection after Welcome
+}
+
+// Welcome message is sent from server to client as reply to Hello.
+type Welcome struct {
+	Version     string // server version
+	Protocol    int    // server wire protocol version
+	Accepted    bool
+	Reason      string // why the client was refused
+	ResumeToken string // send back in Hello to resume the cannon after reconnecting
+	Resumed     bool   // previous cannon was resumed
+	Codec       string // codec chosen for messages after the handshake
+	Rules       Rules  // game rules enforced by server
+	Room        string // joined room
+	Rooms       []Room // rooms in server
+}
+
+// DefaultRoom is joined by clients not asking for a room.
+const DefaultRoom = "main"
+
+// Room describes a server room, see Welcome.Rooms.
+type Room struct {
+	Name    string
+	Clients int // connected players and spectators
+}
+
+// Rules are the game rules advertised by the server,
+// thus clients predict consistently with the server.
+type Rules struct {
+	MissileSpeed  float32 // field height per second
+	CannonSpeed   float32 // field width per second
+	MissileDamage float32 // cannon life lost per hit, full life is 1
+	FuelCost      float32 // fuel consumed per missile
+	FuelRecharge  float32 // fuel recharged per second
+	FuelStart     float32 // fuel for spawned cannon, maximum fuel is 10
+
+	MissileIntercept bool // opposing missiles overlapping destroy each other
+}
+
+// TeamSpectator is the Update.Team sent to spectators.
+const TeamSpectator = -1
+
+// Match phases, see Update.Match.
+const (
+	MatchLobby     = 0 // waiting for players in both teams
+	MatchCountdown = 1 // round about to start
+	MatchPlaying   = 2
+	MatchOver      = 3 // round over, winner announced
+)
+
+// WinnerDraw is the Update.Winner of a round ending in a draw.
+const WinnerDraw = -1
+
 // Update message is sent from server do client.
+// A full update (keyframe) carries all missiles and cannons.
+// A delta update carries only the missiles and cannons created or changed
+// since the update Base, plus the IDs of those removed since Base.
 type Update struct {
-	Fuel          float32
-	Interval      time.Duration // notify client about update interval
-	WorldMissiles []*Missile
-	Cannons       []*Cannon
-	Team          int // notify player about his team
-	Scores        [2]int
-	FireSound     bool
+	Fuel            float32
+	Interval        time.Duration // notify client about update interval
+	WorldMissiles   []*Missile
+	Cannons         []*Cannon
+	Team            int // notify player about his team, or TeamSpectator
+	Scores          [2]int
+	FireSound       bool
+	Seq             int  // update sequence number
+	Base            int  // delta is relative to this update. In keyframe, oldest base server may still use
+	Full            bool // keyframe
+	RemovedMissiles []int
+	RemovedCannons  []int
+	Match           int           // match phase
+	MatchLeft       time.Duration // time left in match phase, 0 if unlimited
+	Round           int           // round number
+	Winner          int           // team that won the round, or WinnerDraw. Valid in MatchOver
+	Rules           *Rules        // game rules, sent in keyframes and after rules change
+	Queued          int           // position in matchmaking queue, 1 is next. 0 if not queued
+	Now             time.Time     // server time of update. Item position at Now is extrapolated from Coord at Start
+	Paused          bool          // world paused by admin, items hold still
+	Notice          string        // text broadcast by admin
+	Intercepts      []*Intercept  // missiles destroyed by each other since the previous update
 }
 
 const (
@@ -37,6 +122,14 @@ type Missile struct {
 	Start  time.Time
 }
 
+// Intercept reports opposing missiles destroying each other, see Rules.MissileIntercept.
+// Position is that of the Team missile at impact, thus clients draw it like a missile.
+type Intercept struct {
+	CoordX float32
+	CoordY float32
+	Team   int
+}
+
 // Cannon belongs to player.
 type Cannon struct {
 	ID     int
@@ -46,4 +139,7 @@ type Cannon struct {
 	Team   int
 	Player bool // belongs to player
 	Life   float32
+
+	Respawn      time.Time // when destroyed cannon respawns, zero if alive or no respawn
+	Invulnerable bool      // missiles pass through cannon after respawn
 }
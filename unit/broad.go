@@ -0,0 +1,58 @@
+package unit
+
+import (
+	"sort"
+)
+
+// Span is the extent of an item along one axis, for broad phase collision.
+type Span struct {
+	Min   float64
+	Max   float64
+	Index int // caller item
+}
+
+// Overlaps calls fn for each pair of spans from a and b that overlap,
+// touching counts as overlap like Rect intersection.
+// It sorts a and b by Min, then sweeps both lists along the axis,
+// thus cost is O(n log n) plus the number of pairs, instead of len(a)*len(b).
+func Overlaps(a, b []Span, fn func(sa, sb Span)) {
+	sortSpans(a)
+	sortSpans(b)
+
+	var activeA, activeB []Span // spans that may still overlap the next ones
+
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		if j == len(b) || (i < len(a) && a[i].Min <= b[j].Min) {
+			s := a[i]
+			i++
+			activeB = prune(activeB, s.Min)
+			for _, sb := range activeB {
+				fn(s, sb)
+			}
+			activeA = append(activeA, s)
+			continue
+		}
+		s := b[j]
+		j++
+		activeA = prune(activeA, s.Min)
+		for _, sa := range activeA {
+			fn(sa, s)
+		}
+		activeB = append(activeB, s)
+	}
+}
+
+func sortSpans(s []Span) {
+	sort.Slice(s, func(i, j int) bool { return s[i].Min < s[j].Min })
+}
+
+// prune drops spans ending before min.
+func prune(active []Span, min float64) []Span {
+	keep := active[:0]
+	for _, s := range active {
+		if s.Max >= min {
+			keep = append(keep, s)
+		}
+	}
+	return keep
+}
@@ -0,0 +1,49 @@
+package unit
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestOverlaps(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	spans := func(n int) []Span {
+		s := make([]Span, n)
+		for i := range s {
+			min := rnd.Float64()
+			s[i] = Span{Min: min, Max: min + rnd.Float64()*.1, Index: i}
+		}
+		return s
+	}
+	a := spans(200)
+	b := spans(300)
+	b = append(b, Span{Min: a[0].Max, Max: a[0].Max + 1, Index: len(b)}) // touching
+
+	// every pair
+	expected := map[[2]int]bool{}
+	for _, sa := range a {
+		for _, sb := range b {
+			if sa.Min <= sb.Max && sb.Min <= sa.Max {
+				expected[[2]int{sa.Index, sb.Index}] = true
+			}
+		}
+	}
+
+	result := map[[2]int]bool{}
+	Overlaps(a, b, func(sa, sb Span) {
+		pair := [2]int{sa.Index, sb.Index}
+		if result[pair] {
+			t.Errorf("pair reported twice: %v", pair)
+		}
+		result[pair] = true
+	})
+
+	if len(result) != len(expected) {
+		t.Errorf("pairs: expected=%d result=%d", len(expected), len(result))
+	}
+	for pair := range expected {
+		if !result[pair] {
+			t.Errorf("missing pair: %v", pair)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package unit
+
+import (
+	"image"
+	"math"
+)
+
+// MaskAlphaMin is the minimum alpha of an opaque pixel.
+const MaskAlphaMin = 0x80
+
+// Mask holds the opaque pixels of a sprite, for pixel accurate collision.
+// The sprite is stretched over its bounding box: image top at box top when facing up,
+// rotated 180 degrees when facing down, as drawn by the client.
+// A nil Mask is fully opaque, thus it behaves like the bounding box.
+type Mask struct {
+	Width  int
+	Height int
+	opaque []bool // row-major, row 0 is image top
+}
+
+// NewMask builds the mask from the image alpha channel, downsampled to at most size cells
+// along the longest side, thus collision cost does not depend on image resolution.
+// A cell is opaque if any of its pixels is opaque.
+func NewMask(img *image.NRGBA, size int) *Mask {
+	b := img.Bounds()
+	cell := 1
+	for b.Dx() > size*cell || b.Dy() > size*cell {
+		cell++
+	}
+	m := &Mask{
+		Width:  (b.Dx() + cell - 1) / cell,
+		Height: (b.Dy() + cell - 1) / cell,
+	}
+	m.opaque = make([]bool, m.Width*m.Height)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if img.NRGBAAt(b.Min.X+x, b.Min.Y+y).A >= MaskAlphaMin {
+				m.opaque[(y/cell)*m.Width+x/cell] = true
+			}
+		}
+	}
+	return m
+}
+
+// Coverage returns the fraction of opaque pixels.
+func (m *Mask) Coverage() float64 {
+	if m == nil || len(m.opaque) == 0 {
+		return 1
+	}
+	var n int
+	for _, o := range m.opaque {
+		if o {
+			n++
+		}
+	}
+	return float64(n) / float64(len(m.opaque))
+}
+
+// Opaque reports whether the sprite is opaque at point (u,v) of its box,
+// from (0,0) at box bottom-left to (1,1) at box top-right.
+func (m *Mask) Opaque(u, v float64, up bool) bool {
+	if m == nil {
+		return true
+	}
+	if u < 0 || u > 1 || v < 0 || v > 1 {
+		return false
+	}
+	if !up {
+		u, v = 1-u, 1-v // rotated 180 degrees
+	}
+	x := int(u * float64(m.Width))
+	if x == m.Width {
+		x-- // right border
+	}
+	y := int((1 - v) * float64(m.Height))
+	if y == m.Height {
+		y-- // bottom border
+	}
+	return m.opaque[y*m.Width+x]
+}
+
+// pixel returns the pixel size in box units, or false for nil mask.
+func (m *Mask) pixel(r Rect) (float64, float64, bool) {
+	if m == nil {
+		return 0, 0, false
+	}
+	return (r.X2 - r.X1) / float64(m.Width), (r.Y2 - r.Y1) / float64(m.Height), true
+}
+
+// PixelSize returns the size in box units of the smallest pixel of both sprites, or false if both masks are nil.
+func PixelSize(a *Mask, ar Rect, b *Mask, br Rect) (float64, float64, bool) {
+	ax, ay, aOk := a.pixel(ar)
+	bx, by, bOk := b.pixel(br)
+	switch {
+	case aOk && bOk:
+		return math.Min(ax, bx), math.Min(ay, by), true
+	case aOk:
+		return ax, ay, true
+	case bOk:
+		return bx, by, true
+	}
+	return 0, 0, false
+}
+
+// MaskOverlap reports whether opaque pixels of both sprites overlap.
+// It is meant to run after the bounding box test, as narrow phase.
+func MaskOverlap(a *Mask, ar Rect, aUp bool, b *Mask, br Rect, bUp bool) bool {
+	i, overlap := intersection(ar, br)
+	if !overlap {
+		return false
+	}
+	dx, dy, masked := PixelSize(a, ar, b, br)
+	if !masked {
+		return true // boxes only
+	}
+	// sample pixel centers of the finer sprite
+	for y := i.Y1 + dy/2; y < i.Y2; y += dy {
+		for x := i.X1 + dx/2; x < i.X2; x += dx {
+			if a.Opaque(boxU(ar, x), boxV(ar, y), aUp) && b.Opaque(boxU(br, x), boxV(br, y), bUp) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MaskRect reports whether opaque pixels of the sprite overlap the rectangle.
+func MaskRect(a *Mask, ar Rect, aUp bool, r Rect) bool {
+	return MaskOverlap(a, ar, aUp, nil, r, true)
+}
+
+// intersection returns the overlap of both rectangles.
+func intersection(a, b Rect) (Rect, bool) {
+	i := Rect{
+		X1: math.Max(a.X1, b.X1),
+		Y1: math.Max(a.Y1, b.Y1),
+		X2: math.Min(a.X2, b.X2),
+		Y2: math.Min(a.Y2, b.Y2),
+	}
+	return i, i.X1 <= i.X2 && i.Y1 <= i.Y2
+}
+
+func boxU(r Rect, x float64) float64 {
+	return (x - r.X1) / (r.X2 - r.X1)
+}
+
+func boxV(r Rect, y float64) float64 {
+	return (y - r.Y1) / (r.Y2 - r.Y1)
+}
@@ -0,0 +1,67 @@
+package unit
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newTestMask builds a 2x2 sprite opaque only at the given pixel.
+func newTestMask(x, y int) *Mask {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.SetNRGBA(x, y, color.NRGBA{A: 255})
+	return NewMask(img, 2)
+}
+
+func TestMaskDownsample(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	img.SetNRGBA(99, 49, color.NRGBA{A: 255}) // bottom-right pixel
+	m := NewMask(img, 10)
+	if m.Width != 10 || m.Height != 5 {
+		t.Errorf("size: expected=10x5 result=%dx%d", m.Width, m.Height)
+	}
+	if !m.Opaque(.99, .01, true) || m.Opaque(.01, .99, true) {
+		t.Errorf("downsampled mask lost opaque cell")
+	}
+}
+
+func TestMaskRect(t *testing.T) {
+	m := newTestMask(0, 0) // top-left opaque
+	box := Rect{X1: 0, Y1: 0, X2: 1, Y2: 1}
+
+	topLeft := Rect{X1: .1, Y1: .6, X2: .4, Y2: .9}
+	topRight := Rect{X1: .6, Y1: .6, X2: .9, Y2: .9}
+	bottomRight := Rect{X1: .6, Y1: .1, X2: .9, Y2: .4}
+
+	if !MaskRect(m, box, true, topLeft) {
+		t.Errorf("opaque corner: expected hit")
+	}
+	if MaskRect(m, box, true, topRight) {
+		t.Errorf("transparent corner: expected miss")
+	}
+	if !MaskRect(m, box, false, bottomRight) {
+		t.Errorf("sprite facing down: opaque corner rotated to bottom-right: expected hit")
+	}
+	if !MaskRect(nil, box, true, topRight) {
+		t.Errorf("nil mask: expected box hit")
+	}
+}
+
+func TestMaskOverlap(t *testing.T) {
+	a := newTestMask(0, 0) // top-left opaque
+	b := newTestMask(0, 0)
+	ar := Rect{X1: 0, Y1: 0, X2: 1, Y2: 1}
+
+	// b box overlaps a top-left quadrant with its bottom-right quadrant
+	br := Rect{X1: -.5, Y1: .5, X2: .5, Y2: 1.5}
+
+	if MaskOverlap(a, ar, true, b, br, true) {
+		t.Errorf("boxes overlap on transparent pixels: expected miss")
+	}
+	if !MaskOverlap(a, ar, true, b, br, false) {
+		t.Errorf("b facing down: opaque pixels overlap: expected hit")
+	}
+	if MaskOverlap(a, ar, true, b, Rect{X1: 2, Y1: 2, X2: 3, Y2: 3}, true) {
+		t.Errorf("boxes apart: expected miss")
+	}
+}
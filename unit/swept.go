@@ -0,0 +1,53 @@
+package unit
+
+import (
+	"math"
+)
+
+// Contact returns the earliest time within [0,maxT] when box a, moving with velocity (avx,avy),
+// overlaps box b, moving with velocity (bvx,bvy). Boxes touching count as overlap, like static intersection.
+// Velocities are in box units per time unit.
+// It returns false if the boxes do not meet within the interval.
+func Contact(a Rect, avx, avy float64, b Rect, bvx, bvy float64, maxT float64) (float64, bool) {
+	enter, _, ok := ContactSpan(a, avx, avy, b, bvx, bvy, maxT)
+	return enter, ok
+}
+
+// ContactSpan is like Contact, also returning the last time within [0,maxT] the boxes overlap.
+func ContactSpan(a Rect, avx, avy float64, b Rect, bvx, bvy float64, maxT float64) (float64, float64, bool) {
+	// move b relative to a
+	vx := bvx - avx
+	vy := bvy - avy
+
+	enterX, exitX, okX := axisContact(a.X1, a.X2, b.X1, b.X2, vx)
+	if !okX {
+		return 0, 0, false
+	}
+	enterY, exitY, okY := axisContact(a.Y1, a.Y2, b.Y1, b.Y2, vy)
+	if !okY {
+		return 0, 0, false
+	}
+
+	enter := math.Max(0, math.Max(enterX, enterY))
+	exit := math.Min(maxT, math.Min(exitX, exitY))
+	if enter > exit {
+		return 0, 0, false
+	}
+	return enter, exit, true
+}
+
+// axisContact returns the time interval when segment [b1,b2] moving with velocity v overlaps static segment [a1,a2].
+func axisContact(a1, a2, b1, b2, v float64) (float64, float64, bool) {
+	if v == 0 {
+		if b1 > a2 || a1 > b2 {
+			return 0, 0, false // never
+		}
+		return math.Inf(-1), math.Inf(1), true // always
+	}
+	t1 := (a1 - b2) / v
+	t2 := (a2 - b1) / v
+	if t1 > t2 {
+		t1, t2 = t2, t1
+	}
+	return t1, t2, true
+}
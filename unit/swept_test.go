@@ -0,0 +1,38 @@
+package unit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestContact(t *testing.T) {
+	static := Rect{X1: 0, Y1: 0, X2: 1, Y2: 1}
+
+	contact(t, "static overlap", static, 0, 0, Rect{X1: .5, Y1: .5, X2: 2, Y2: 2}, 0, 0, 1, 0, true)
+	contact(t, "static apart", static, 0, 0, Rect{X1: 2, Y1: 2, X2: 3, Y2: 3}, 0, 0, 1, 0, false)
+
+	// thin box crossing the static box within one step: sampling at 0 and 1 would miss it
+	fast := Rect{X1: .4, Y1: -3, X2: .6, Y2: -2.9}
+	contact(t, "tunneling", static, 0, 0, fast, 0, 10, 1, .29, true)
+	contact(t, "too late", static, 0, 0, fast, 0, 10, .2, 0, false)
+
+	// both moving: a right, b left
+	contact(t, "both moving", static, 1, 0, Rect{X1: 4, Y1: 0, X2: 5, Y2: 1}, -1, 0, 10, 1.5, true)
+
+	// moving away
+	contact(t, "moving away", static, 0, 0, Rect{X1: 2, Y1: 0, X2: 3, Y2: 1}, 1, 0, 10, 0, false)
+
+	// passing beside
+	contact(t, "beside", static, 0, 0, Rect{X1: 2, Y1: -3, X2: 3, Y2: -2}, 0, 10, 1, 0, false)
+}
+
+func contact(t *testing.T, name string, a Rect, avx, avy float64, b Rect, bvx, bvy, maxT, expected float64, expectedFound bool) {
+	result, found := Contact(a, avx, avy, b, bvx, bvy, maxT)
+	if found != expectedFound {
+		t.Errorf("%s: expected found=%v result found=%v at %v", name, expectedFound, found, result)
+		return
+	}
+	if found && math.Abs(result-expected) > 1e-9 {
+		t.Errorf("%s: expected=%v result=%v", name, expected, result)
+	}
+}